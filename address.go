@@ -0,0 +1,63 @@
+package graylog
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultGelfPort port of graylog's GELF inputs, used when the address has none
+const DefaultGelfPort = 12201
+
+// isTCP reports whether the network is stream oriented
+func (n NetworkType) isTCP() bool {
+	return strings.HasPrefix(string(n), "tcp") || n == TLS
+}
+
+var gelfNetworks = map[string]NetworkType{
+	"udp":  UDP,
+	"udp4": UDP4,
+	"udp6": UDP6,
+	"tcp":  TCP,
+	"tcp4": TCP4,
+	"tcp6": TCP6,
+	"dtls": DTLS,
+	"tls":  TLS,
+}
+
+// parseGelfAddr parses scheme://host[:port] into a network and a host:port
+// suitable for net.Dial. allowEmptyHost accepts listen addresses like udp://:12201.
+func parseGelfAddr(raw string, allowEmptyHost bool) (NetworkType, string, error) {
+	if !strings.Contains(raw, "://") {
+		return "", "", fmt.Errorf("invalid address %q: missing scheme, expected e.g. udp://%s", raw, raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid address %q: %w", raw, err)
+	}
+	networkType, ok := gelfNetworks[strings.ToLower(u.Scheme)]
+	if !ok {
+		return "", "", fmt.Errorf("invalid address %q: unknown scheme %s, expected one of udp, udp4, udp6, tcp, tcp4, tcp6, dtls, tls", raw, u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" || u.RawQuery != "" || u.User != nil {
+		return "", "", fmt.Errorf("invalid address %q: only scheme://host:port is supported", raw)
+	}
+
+	host := u.Hostname()
+	if host == "" && !allowEmptyHost {
+		return "", "", fmt.Errorf("invalid address %q: missing host", raw)
+	}
+	port := u.Port()
+	if port == "" {
+		if strings.HasSuffix(u.Host, ":") {
+			return "", "", fmt.Errorf("invalid address %q: missing port after ':'", raw)
+		}
+		port = strconv.Itoa(DefaultGelfPort)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return "", "", fmt.Errorf("invalid address %q: invalid port %s", raw, port)
+	}
+	return networkType, net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,145 @@
+package graylog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type AuditOptions struct {
+	// Path of the NDJSON audit file
+	Path string
+	// MaxSize rotate the file once it grows beyond this many bytes, default 100MB
+	MaxSize int64
+	// MaxBackups number of rotated files kept as Path.1 ... Path.N, default 3
+	MaxBackups int
+}
+
+// auditStop sentinel pushed to the queue on Close
+type auditStop struct{}
+
+// auditBackend tees every successfully sent message to a local rotating file
+type auditBackend struct {
+	Backend
+	opts  AuditOptions
+	file  *os.File
+	size  int64
+	queue *BlockingList
+	done  chan struct{}
+	// mu 保护closed，Close等待进行中的发送把消息放入队列
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditBackend wraps inner so that every message it accepts is also appended,
+// asynchronously, to a local NDJSON file. The audit trail doesn't slow down or
+// fail sends: write errors are only printed.
+func NewAuditBackend(inner Backend, opts AuditOptions) (Backend, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 100 << 20
+	}
+	if opts.MaxBackups <= 0 {
+		opts.MaxBackups = 3
+	}
+	a := &auditBackend{
+		Backend: inner,
+		opts:    opts,
+		queue:   NewBlockingList(),
+		done:    make(chan struct{}),
+	}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	go a.run()
+	return a, nil
+}
+
+func (a *auditBackend) open() error {
+	f, err := os.OpenFile(a.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// rotate 轮转文件: path -> path.1 -> path.2 ...
+func (a *auditBackend) rotate() error {
+	_ = a.file.Close()
+	for i := a.opts.MaxBackups - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", a.opts.Path, i), fmt.Sprintf("%s.%d", a.opts.Path, i+1))
+	}
+	err := os.Rename(a.opts.Path, a.opts.Path+".1")
+	if oErr := a.open(); oErr != nil {
+		return oErr
+	}
+	return err
+}
+
+func (a *auditBackend) run() {
+	defer close(a.done)
+	for {
+		v := a.queue.FrontBlock()
+		if _, ok := v.(auditStop); ok {
+			return
+		}
+		if err := a.write(v.(*GELFMessage)); err != nil {
+			internalLog.Printf("audit write error: %v\n", err)
+		}
+	}
+}
+
+func (a *auditBackend) write(message *GELFMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if a.size > 0 && a.size+int64(len(data)) > a.opts.MaxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := a.file.Write(data)
+	a.size += int64(n)
+	return err
+}
+
+func (a *auditBackend) SendMessage(message *GELFMessage) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return errors.New("audit backend is closed")
+	}
+	if err := a.Backend.SendMessage(message); err != nil {
+		return err
+	}
+	a.queue.PushBack(message)
+	return nil
+}
+
+// Close closes inner and the audit file once the queued messages are written,
+// later calls return nil
+func (a *auditBackend) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+
+	err := a.Backend.Close()
+	a.queue.PushBack(auditStop{})
+	<-a.done
+	_ = a.file.Close()
+	return err
+}
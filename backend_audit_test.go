@@ -0,0 +1,41 @@
+package graylog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditSendAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	inner := NewRecordingBackend()
+	backend, err := NewAuditBackend(inner, AuditOptions{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}
+	if err := backend.SendMessage(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SendMessage(m); err == nil {
+		t.Fatal("send after Close succeeded")
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 1 {
+		t.Errorf("audit file holds %d messages, want 1", n)
+	}
+	if n := len(inner.Messages()); n != 1 {
+		t.Errorf("inner received %d messages, want 1", n)
+	}
+}
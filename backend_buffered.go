@@ -0,0 +1,63 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+)
+
+// bufferedBackend stages messages in a bounded buffer drained by its own flusher
+type bufferedBackend struct {
+	Backend
+	ch     chan *GELFMessage
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBufferedBackend puts a staging buffer of size messages in front of inner,
+// so a momentary stall of inner (tcp retransmit, redis hiccup) doesn't block
+// the hook's workers until the buffer is full. Send errors of inner are
+// reported through the internal logger. default size 1000
+func NewBufferedBackend(inner Backend, size int) Backend {
+	if size <= 0 {
+		size = 1000
+	}
+	b := &bufferedBackend{
+		Backend: inner,
+		ch:      make(chan *GELFMessage, size),
+		done:    make(chan struct{}),
+	}
+	go b.flush()
+	return b
+}
+
+func (b *bufferedBackend) flush() {
+	defer close(b.done)
+	for message := range b.ch {
+		if err := b.Backend.SendMessage(message); err != nil {
+			internalLog.Printf("buffered backend: %v", err)
+		}
+	}
+}
+
+func (b *bufferedBackend) SendMessage(message *GELFMessage) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return errors.New("buffered backend is closed")
+	}
+	b.ch <- message
+	return nil
+}
+
+// Close sends the buffered messages, then closes inner
+func (b *bufferedBackend) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.ch)
+	}
+	b.mu.Unlock()
+	<-b.done
+	return b.Backend.Close()
+}
@@ -0,0 +1,128 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// CompositeOptions options of NewCompositeBackend
+type CompositeOptions struct {
+	// FailureThreshold consecutive failures after which a backend is marked
+	// unhealthy and skipped, default 1
+	FailureThreshold int
+	// RetryInterval how long an unhealthy backend is skipped. The next message
+	// after it is tried on the backend again, which fails back to it when the
+	// send succeeds. default 30s
+	RetryInterval time.Duration
+	// OnHealthChange is called when a backend, by its index, is marked
+	// unhealthy or recovers, e.g. to alert on a failover
+	OnHealthChange func(index int, healthy bool)
+}
+
+type compositeTarget struct {
+	backend  Backend
+	failures int
+	// retryAt 非零时不健康，到时间后重新尝试
+	retryAt time.Time
+}
+
+// compositeBackend sends each message to the first healthy backend of its chain
+type compositeBackend struct {
+	opts    CompositeOptions
+	mu      sync.Mutex
+	targets []*compositeTarget
+}
+
+// NewCompositeBackend returns a backend sending each message to the first
+// healthy backend of an ordered chain, falling back to the next one on error,
+// e.g. gelf tcp first, a redis queue second and a local file as last resort.
+// Unhealthy backends are tried again every RetryInterval, traffic fails back
+// to them as soon as they succeed. When every healthy backend failed, the
+// unhealthy ones are tried too before the errors are returned.
+func NewCompositeBackend(backends []Backend, opts CompositeOptions) Backend {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 1
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 30 * time.Second
+	}
+	c := &compositeBackend{opts: opts}
+	for _, backend := range backends {
+		c.targets = append(c.targets, &compositeTarget{backend: backend})
+	}
+	return c
+}
+
+// available 健康的或已到重试时间的目标
+func (c *compositeBackend) available(t *compositeTarget, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return t.retryAt.IsZero() || !now.Before(t.retryAt)
+}
+
+func (c *compositeBackend) observe(i int, err error) {
+	t := c.targets[i]
+	c.mu.Lock()
+	wasHealthy := t.retryAt.IsZero()
+	if err == nil {
+		t.failures = 0
+		t.retryAt = time.Time{}
+	} else {
+		t.failures++
+		if !wasHealthy || t.failures >= c.opts.FailureThreshold {
+			t.retryAt = time.Now().Add(c.opts.RetryInterval)
+		}
+	}
+	healthy := t.retryAt.IsZero()
+	c.mu.Unlock()
+
+	if healthy != wasHealthy && c.opts.OnHealthChange != nil {
+		c.opts.OnHealthChange(i, healthy)
+	}
+}
+
+func (c *compositeBackend) SendMessage(message *GELFMessage) error {
+	now := time.Now()
+	var errs []error
+	var skipped []int
+	for i, t := range c.targets {
+		if !c.available(t, now) {
+			skipped = append(skipped, i)
+			continue
+		}
+		err := t.backend.SendMessage(message)
+		c.observe(i, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	// 健康的都失败了，最后尝试不健康的
+	for _, i := range skipped {
+		err := c.targets[i].backend.SendMessage(message)
+		c.observe(i, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return errors.New("composite backend has no backends")
+	}
+	return errors.Join(errs...)
+}
+
+func (c *compositeBackend) Close() error {
+	var errs []error
+	for _, t := range c.targets {
+		if err := t.backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *compositeBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("composite backend does not support consuming")
+}
@@ -0,0 +1,91 @@
+//go:build windows
+
+package graylog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+type EventLogOptions struct {
+	// Source event source name shown in the event viewer
+	Source string
+	// EventID id attached to every event, default 1
+	EventID uint32
+	// InstallSource registers Source in the registry if it doesn't exist yet,
+	// requires administrator rights. default false
+	InstallSource bool
+}
+
+type eventLogBackend struct {
+	log     *eventlog.Log
+	eventID uint32
+}
+
+// NewEventLogBackend creates a backend writing messages to the Windows Event
+// Log, usable standalone or as a fallback when graylog is unreachable.
+func NewEventLogBackend(opts EventLogOptions) (Backend, error) {
+	if opts.Source == "" {
+		return nil, errors.New("event log source is required")
+	}
+	if opts.EventID == 0 {
+		opts.EventID = 1
+	}
+	if opts.InstallSource {
+		err := eventlog.InstallAsEventCreate(opts.Source, eventlog.Error|eventlog.Warning|eventlog.Info)
+		if err != nil && !strings.Contains(err.Error(), "registry key already exists") {
+			return nil, err
+		}
+	}
+	log, err := eventlog.Open(opts.Source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogBackend{log: log, eventID: opts.EventID}, nil
+}
+
+// eventText 短消息、完整消息和按名称排序的附加字段
+func eventText(m *GELFMessage) string {
+	var b strings.Builder
+	b.WriteString(m.Short)
+	if m.Full != "" {
+		b.WriteString("\n\n")
+		b.WriteString(m.Full)
+	}
+	keys := make([]string, 0, len(m.Extra))
+	for k := range m.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		b.WriteString("\n")
+	}
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s=%v", strings.TrimPrefix(k, "_"), m.Extra[k])
+	}
+	return b.String()
+}
+
+func (e *eventLogBackend) SendMessage(message *GELFMessage) error {
+	text := eventText(message)
+	switch {
+	case message.Level <= LogErr:
+		return e.log.Error(e.eventID, text)
+	case message.Level == LogWarning:
+		return e.log.Warning(e.eventID, text)
+	default:
+		return e.log.Info(e.eventID, text)
+	}
+}
+
+func (e *eventLogBackend) Close() error {
+	return e.log.Close()
+}
+
+func (e *eventLogBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("event log backend does not support consuming")
+}
@@ -0,0 +1,41 @@
+package graylog
+
+import (
+	"errors"
+)
+
+// fanoutBackend sends every message to all of its backends
+type fanoutBackend struct {
+	backends []Backend
+}
+
+// NewFanoutBackend returns a backend sending every message to all backends in
+// order. A failing backend doesn't prevent delivery to the others, the errors
+// are joined and returned.
+func NewFanoutBackend(backends ...Backend) Backend {
+	return &fanoutBackend{backends: backends}
+}
+
+func (f *fanoutBackend) SendMessage(message *GELFMessage) error {
+	var errs []error
+	for _, backend := range f.backends {
+		if err := backend.SendMessage(message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanoutBackend) Close() error {
+	var errs []error
+	for _, backend := range f.backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fanoutBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("fanout backend does not support consuming")
+}
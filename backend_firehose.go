@@ -0,0 +1,283 @@
+package graylog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// firehoseMaxRecords firehoseMaxBatchBytes limits of one PutRecordBatch call
+	firehoseMaxRecords    = 500
+	firehoseMaxBatchBytes = 4 << 20
+	// firehoseMaxRecordBytes limit of one record
+	firehoseMaxRecordBytes = 1000 << 10
+	// firehoseMaxFullBatches full batches waiting for batchLoop before
+	// SendMessage waits
+	firehoseMaxFullBatches = 4
+)
+
+// FirehoseRecord one record of a PutRecordBatch call: a GELF message as a JSON
+// line, and its partition key when FirehoseOptions.PartitionKey is set
+type FirehoseRecord struct {
+	Data         []byte
+	PartitionKey string
+}
+
+// FirehoseClient is the part of a Kinesis Firehose client used by the firehose
+// backend, it returns the indexes of the records that failed. With
+// github.com/aws/aws-sdk-go-v2/service/firehose it is a small adapter:
+//
+//	type client struct {
+//		*firehose.Client
+//		stream string
+//	}
+//
+//	func (c client) PutRecordBatch(ctx context.Context, records []graylog.FirehoseRecord) ([]int, error) {
+//		input := &firehose.PutRecordBatchInput{DeliveryStreamName: &c.stream}
+//		for _, r := range records {
+//			input.Records = append(input.Records, types.Record{Data: r.Data})
+//		}
+//		out, err := c.Client.PutRecordBatch(ctx, input)
+//		if err != nil {
+//			return nil, err
+//		}
+//		var failed []int
+//		for i, r := range out.RequestResponses {
+//			if r.ErrorCode != nil {
+//				failed = append(failed, i)
+//			}
+//		}
+//		return failed, nil
+//	}
+type FirehoseClient interface {
+	PutRecordBatch(ctx context.Context, records []FirehoseRecord) (failed []int, err error)
+}
+
+type FirehoseOptions struct {
+	// Client puts the records to the delivery stream, required
+	Client FirehoseClient
+	// PartitionKey computes the partition key of a message, e.g.
+	// RoutingKeyField("tenant"). Firehose has no key per record: the key is
+	// added to the record in PartitionKeyField, for the dynamic partitioning
+	// of the delivery stream to extract it. default none
+	PartitionKey RoutingKey
+	// PartitionKeyField additional field holding the partition key, default _partition_key
+	PartitionKeyField string
+	// BatchSize maximum number of records per call, default and maximum 500
+	BatchSize int
+	// BatchWindow maximum time a message waits for its batch to fill up, default 1s
+	BatchWindow time.Duration
+	// MaxRetries retries of the records Firehose failed, after the first
+	// attempt, default 3
+	MaxRetries int
+	// SendTimeout bounds each PutRecordBatch call, default 10s
+	SendTimeout time.Duration
+}
+
+type firehoseBackend struct {
+	opts    FirehoseOptions
+	batchMu sync.Mutex
+	batch   []FirehoseRecord
+	size    int
+	// full 等待batchLoop发送的批次，batchFree在取走时通知
+	full      [][]FirehoseRecord
+	batchFree *sync.Cond
+	wake      chan struct{}
+	closed    bool
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewFirehoseBackend creates a backend streaming messages to a Kinesis
+// Firehose delivery stream, e.g. feeding S3 or OpenSearch. Messages are sent
+// as JSON lines, batched into PutRecordBatch calls within the service limits.
+// Batches are put by a background goroutine, SendMessage only waits when it
+// falls behind. Failed records are retried, batches that still fail are
+// reported through the internal logger. The client is provided by the caller
+// through FirehoseOptions.
+func NewFirehoseBackend(opts FirehoseOptions) (Backend, error) {
+	if opts.Client == nil {
+		return nil, errors.New("firehose backend requires FirehoseOptions.Client")
+	}
+	if opts.PartitionKeyField == "" {
+		opts.PartitionKeyField = "_partition_key"
+	}
+	opts.PartitionKeyField = fieldKey(opts.PartitionKeyField)
+	if opts.BatchSize <= 0 || opts.BatchSize > firehoseMaxRecords {
+		opts.BatchSize = firehoseMaxRecords
+	}
+	if opts.BatchWindow <= 0 {
+		opts.BatchWindow = time.Second
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.SendTimeout <= 0 {
+		opts.SendTimeout = 10 * time.Second
+	}
+	f := &firehoseBackend{opts: opts, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	f.batchFree = sync.NewCond(&f.batchMu)
+	f.wg.Add(1)
+	go f.batchLoop()
+	return f, nil
+}
+
+// record 序列化为一行JSON，分区键写入消息
+func (f *firehoseBackend) record(message *GELFMessage) (FirehoseRecord, error) {
+	var key string
+	if f.opts.PartitionKey != nil {
+		key = f.opts.PartitionKey(message)
+	}
+	if key != "" {
+		c := *message
+		c.Extra = make(map[string]interface{}, len(message.Extra)+1)
+		for k, v := range message.Extra {
+			c.Extra[k] = v
+		}
+		c.Extra[f.opts.PartitionKeyField] = key
+		message = &c
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return FirehoseRecord{}, err
+	}
+	data = append(data, '\n')
+	if len(data) > firehoseMaxRecordBytes {
+		return FirehoseRecord{}, fmt.Errorf("message of %d bytes exceeds the firehose record limit of %d", len(data), firehoseMaxRecordBytes)
+	}
+	return FirehoseRecord{Data: data, PartitionKey: key}, nil
+}
+
+func (f *firehoseBackend) SendMessage(message *GELFMessage) error {
+	record, err := f.record(message)
+	if err != nil {
+		return err
+	}
+
+	f.batchMu.Lock()
+	defer f.batchMu.Unlock()
+	for len(f.full) >= firehoseMaxFullBatches && !f.closed {
+		f.batchFree.Wait()
+	}
+	if f.closed {
+		return errors.New("firehose backend is closed")
+	}
+	if f.size+len(record.Data) > firehoseMaxBatchBytes {
+		f.pushFull()
+	}
+	f.batch = append(f.batch, record)
+	f.size += len(record.Data)
+	if len(f.batch) >= f.opts.BatchSize {
+		f.pushFull()
+	}
+	return nil
+}
+
+// pushFull 把当前批次交给batchLoop，调用时持有batchMu
+func (f *firehoseBackend) pushFull() {
+	if len(f.batch) == 0 {
+		return
+	}
+	f.full = append(f.full, f.take())
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take 取出当前批次，调用时持有batchMu
+func (f *firehoseBackend) take() []FirehoseRecord {
+	batch := f.batch
+	f.batch = nil
+	f.size = 0
+	return batch
+}
+
+func (f *firehoseBackend) batchLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.opts.BatchWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.wake:
+			f.flush(false)
+		case <-ticker.C:
+			f.flush(true)
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// flush 发送满的批次，partial为true时也发送未满的批次，失败记录到internalLog
+func (f *firehoseBackend) flush(partial bool) error {
+	f.batchMu.Lock()
+	if partial {
+		f.pushFull()
+	}
+	full := f.full
+	f.full = nil
+	f.batchFree.Broadcast()
+	f.batchMu.Unlock()
+
+	var errs []error
+	for _, batch := range full {
+		if err := f.put(batch); err != nil {
+			internalLog.Printf("firehose put error: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// put 发送一个批次，重试失败的记录
+func (f *firehoseBackend) put(records []FirehoseRecord) error {
+	backoff := 100 * time.Millisecond
+	for retries := 0; ; retries++ {
+		ctx, cancel := context.WithTimeout(context.Background(), f.opts.SendTimeout)
+		failed, err := f.opts.Client.PutRecordBatch(ctx, records)
+		cancel()
+		if err == nil && len(failed) == 0 {
+			return nil
+		}
+		if err == nil {
+			retry := make([]FirehoseRecord, 0, len(failed))
+			for _, i := range failed {
+				if i >= 0 && i < len(records) {
+					retry = append(retry, records[i])
+				}
+			}
+			// 按响应报告的失败数计数，超出范围的下标无法重试
+			err = fmt.Errorf("firehose failed %d records", len(failed))
+			records = retry
+		}
+		if retries >= f.opts.MaxRetries || len(records) == 0 {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Close sends the batched messages
+func (f *firehoseBackend) Close() error {
+	f.batchMu.Lock()
+	if f.closed {
+		f.batchMu.Unlock()
+		return nil
+	}
+	f.closed = true
+	f.batchFree.Broadcast()
+	f.batchMu.Unlock()
+	close(f.done)
+	f.wg.Wait()
+	return f.flush(true)
+}
+
+func (f *firehoseBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("firehose backend does not support consuming")
+}
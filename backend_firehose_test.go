@@ -0,0 +1,110 @@
+package graylog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeFirehose struct {
+	mu      sync.Mutex
+	calls   int
+	records int
+	// block holds the calls until closed, when set
+	block chan struct{}
+	err   error
+	// failed indexes reported by every call
+	failed []int
+}
+
+func (c *fakeFirehose) PutRecordBatch(ctx context.Context, records []FirehoseRecord) ([]int, error) {
+	if c.block != nil {
+		<-c.block
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.records += len(records)
+	return c.failed, nil
+}
+
+func (c *fakeFirehose) stats() (calls, records int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls, c.records
+}
+
+func firehoseMessage() *GELFMessage {
+	return &GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}
+}
+
+func TestFirehoseSendDoesNotPut(t *testing.T) {
+	client := &fakeFirehose{block: make(chan struct{})}
+	backend, err := NewFirehoseBackend(FirehoseOptions{Client: client, BatchSize: 1, BatchWindow: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < firehoseMaxFullBatches; i++ {
+			if err := backend.SendMessage(firehoseMessage()); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SendMessage waited for PutRecordBatch")
+	}
+	close(client.block)
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, records := client.stats(); records != firehoseMaxFullBatches {
+		t.Errorf("put %d records, want %d", records, firehoseMaxFullBatches)
+	}
+}
+
+func TestFirehoseMaxRetries(t *testing.T) {
+	client := &fakeFirehose{err: errors.New("throttled")}
+	backend, err := NewFirehoseBackend(FirehoseOptions{Client: client, MaxRetries: 2, BatchWindow: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SendMessage(firehoseMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Close(); err == nil {
+		t.Fatal("Close didn't report the failed batch")
+	}
+	if calls, _ := client.stats(); calls != 3 {
+		t.Errorf("made %d attempts, want the first one and 2 retries", calls)
+	}
+}
+
+func TestFirehoseFailedOutOfRange(t *testing.T) {
+	client := &fakeFirehose{failed: []int{7}}
+	backend, err := NewFirehoseBackend(FirehoseOptions{Client: client, BatchWindow: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.SendMessage(firehoseMessage()); err != nil {
+		t.Fatal(err)
+	}
+	err = backend.Close()
+	if err == nil || !strings.Contains(err.Error(), "failed 1 records") {
+		t.Fatalf("Close returned %v, want the failed record counted", err)
+	}
+}
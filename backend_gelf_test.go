@@ -0,0 +1,212 @@
+package graylog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startGelfServer serves tcp GELF on addr and counts the received messages
+func startGelfServer(t *testing.T, addr string) (*GelfServer, *atomic.Int64) {
+	t.Helper()
+	s, err := NewGelfServer(GelfServerOptions{Addr: "tcp://" + addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received atomic.Int64
+	go s.Serve(func(*GELFMessage) error {
+		received.Add(1)
+		return nil
+	})
+	t.Cleanup(func() { _ = s.Close() })
+	return s, &received
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGelfClusterDownNode(t *testing.T) {
+	live, liveReceived := startGelfServer(t, "127.0.0.1:0")
+
+	// a free port nobody listens on yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := l.Addr().String()
+	_ = l.Close()
+
+	backend, err := NewGelfBackendWithOptions(GelfOptions{
+		Addrs: []string{"tcp://" + live.Addr().String(), "tcp://" + deadAddr},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("sends took %v, the down node was tried", elapsed)
+	}
+	waitFor(t, 5*time.Second, func() bool { return liveReceived.Load() == 100 })
+
+	// the node comes up and is redialed in the background
+	_, deadReceived := startGelfServer(t, deadAddr)
+	waitFor(t, 5*time.Second, func() bool {
+		_ = backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"})
+		return deadReceived.Load() > 0
+	})
+}
+
+func TestGelfClusterLazyDownNode(t *testing.T) {
+	live, liveReceived := startGelfServer(t, "127.0.0.1:0")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := l.Addr().String()
+	_ = l.Close()
+
+	backend, err := NewGelfBackendWithOptions(GelfOptions{
+		Addrs:    []string{"tcp://" + live.Addr().String(), "tcp://" + deadAddr},
+		LazyDial: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	// the live node connects in the background
+	waitFor(t, 5*time.Second, func() bool {
+		return backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}) == nil
+	})
+	for i := 0; i < 100; i++ {
+		if err := backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, 5*time.Second, func() bool { return liveReceived.Load() == 101 })
+
+	dead := backend.(*weightedBackend).targets[1].backend.(*lazyBackend)
+	dead.mu.Lock()
+	buffered := len(dead.buffer)
+	dead.mu.Unlock()
+	if buffered != 0 {
+		t.Errorf("%d messages buffered by the node that can't be dialed", buffered)
+	}
+}
+
+func TestGelfClusterAllDown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	if _, err := NewGelfBackendWithOptions(GelfOptions{Addrs: []string{"tcp://" + addr, "tcp://" + addr}}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// syncBuffer collects the internal log in tests
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestGelfReconnectLogRateLimited(t *testing.T) {
+	var logged syncBuffer
+	SetInternalLogger(&logged, time.Hour)
+	defer SetInternalLogger(os.Stdout, 10*time.Second)
+
+	server, _ := startGelfServer(t, "127.0.0.1:0")
+	backend, err := NewGelfBackendWithOptions(GelfOptions{
+		Addrs:                []string{"tcp://" + server.Addr().String()},
+		MaxReconnectAttempts: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	_ = server.Close()
+
+	var reconnectErr *ReconnectError
+	waitFor(t, 10*time.Second, func() bool {
+		err := backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"})
+		return errors.As(err, &reconnectErr)
+	})
+	if n := strings.Count(logged.String(), "retrying"); n != 1 {
+		t.Errorf("retry logged %d times, want once:\n%s", n, logged.String())
+	}
+}
+
+func TestGelfCloseDuringRedial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	backend, err := NewGelfBackendWithOptions(GelfOptions{Addr: "tcp://" + l.Addr().String(), StreamCompression: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := backend.(*gelfBackend)
+	started, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_ = u.redial()
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	<-started
+	if err := backend.Close(); err != nil {
+		t.Error(err)
+	}
+	<-done
+}
@@ -0,0 +1,304 @@
+package graylog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type HTTPOptions struct {
+	// URL graylog GELF HTTP input, e.g. http://127.0.0.1:12201/gelf
+	URL string
+	// Client used to send requests. default a client with its own connection
+	// pool built from MaxIdleConns, Timeout and DialTimeout, which are ignored
+	// when Client is set
+	Client *http.Client
+	// MaxIdleConns idle keep-alive connections kept to the input, default 100
+	MaxIdleConns int
+	// Timeout of a whole request, default 10s
+	Timeout time.Duration
+	// DialTimeout of new connections, default 5s
+	DialTimeout time.Duration
+	// Proxy requests go through this proxy, e.g. http://proxy:3128 or
+	// socks5://proxy:1080. default the proxy set in HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY. Ignored when Client is set
+	Proxy string
+	// DisableCompression send request bodies uncompressed. By default bodies are
+	// gzip compressed, except single messages carrying NoCompressKey
+	DisableCompression bool
+	// CompressionLevel gzip level of request bodies, from gzip.BestSpeed to
+	// gzip.BestCompression, or gzip.HuffmanOnly. default 0 (gzip.BestSpeed),
+	// an invalid level is reported through the internal logger and replaced
+	// by the default
+	CompressionLevel int
+	// BulkSize maximum number of newline-delimited messages sent in one request.
+	// The graylog input must have bulk receiving enabled. default 0 (one message per request)
+	BulkSize int
+	// BulkInterval maximum time a message waits for its bulk to fill up, and
+	// pause before retrying a bulk the input failed. default 1s
+	BulkInterval time.Duration
+	// MaxBulkBuffer messages kept while the input fails, failed bulks are
+	// retried and the oldest messages beyond it dropped (see Dropped).
+	// default 100 * BulkSize
+	MaxBulkBuffer int
+}
+
+type httpBackend struct {
+	url          string
+	client       *http.Client
+	compress     bool
+	level        int
+	bulkSize     int
+	maxBuffer    int
+	interval     time.Duration
+	mu           sync.Mutex
+	pending      bytes.Buffer
+	pendingCount int
+	// retryAt 发送失败后，SendMessage在此之前不触发发送，由flushLoop重试
+	retryAt   time.Time
+	dropped   atomic.Uint64
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewHTTPBackend(opts HTTPOptions) Backend {
+	if opts.Client == nil {
+		opts.Client = newHTTPClient(opts)
+	}
+	if opts.CompressionLevel == 0 {
+		opts.CompressionLevel = gzip.BestSpeed
+	}
+	opts.CompressionLevel = compressionLevelOr("http", CompressionGzip, opts.CompressionLevel, gzip.BestSpeed)
+	if opts.BulkInterval <= 0 {
+		opts.BulkInterval = time.Second
+	}
+	if opts.MaxBulkBuffer < opts.BulkSize {
+		opts.MaxBulkBuffer = 100 * opts.BulkSize
+	}
+	backend := &httpBackend{
+		url:       opts.URL,
+		client:    opts.Client,
+		compress:  !opts.DisableCompression,
+		level:     opts.CompressionLevel,
+		bulkSize:  opts.BulkSize,
+		maxBuffer: opts.MaxBulkBuffer,
+		interval:  opts.BulkInterval,
+		done:      make(chan struct{}),
+	}
+	if backend.bulkSize > 1 {
+		backend.wg.Add(1)
+		go backend.flushLoop(opts.BulkInterval)
+	}
+	return backend
+}
+
+// newHTTPClient 独立的连接池，默认的http.Transport每个host只保留2个空闲连接
+func newHTTPClient(opts HTTPOptions) *http.Client {
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = 100
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.MaxIdleConns = opts.MaxIdleConns
+	transport.MaxIdleConnsPerHost = opts.MaxIdleConns
+	if opts.Proxy != "" {
+		// an invalid proxy fails every request, rather than sending around it
+		proxyURL, err := parseProxyURL(opts.Proxy)
+		transport.Proxy = func(*http.Request) (*url.URL, error) {
+			return proxyURL, err
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: opts.Timeout}
+}
+
+func (h *httpBackend) flushLoop(interval time.Duration) {
+	defer h.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.flush(1, true); err != nil {
+				internalLog.Printf("http bulk flush error: %v\n", err)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// flush 每次发送最多bulkSize条缓存的消息，直到剩下的少于min条。
+// requeue为true时失败的消息放回缓存等待重试，否则丢弃所有缓存的消息
+func (h *httpBackend) flush(min int, requeue bool) error {
+	for {
+		body, count := h.take(min)
+		if count == 0 {
+			return nil
+		}
+		err := h.post(body, h.compress)
+		if err == nil {
+			continue
+		}
+		if requeue {
+			h.requeue(body, count)
+			return err
+		}
+		h.mu.Lock()
+		count += h.pendingCount
+		h.pending.Reset()
+		h.pendingCount = 0
+		h.mu.Unlock()
+		return fmt.Errorf("%d messages lost: %w", count, err)
+	}
+}
+
+// take 取出前面最多bulkSize条消息，缓存少于min条时不取
+func (h *httpBackend) take(min int) ([]byte, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pendingCount == 0 || h.pendingCount < min {
+		return nil, 0
+	}
+	pending := h.pending.Bytes()
+	count, n := 0, 0
+	for count < h.bulkSize && n < len(pending) {
+		n += bytes.IndexByte(pending[n:], '\n') + 1
+		count++
+	}
+	body := make([]byte, n)
+	copy(body, pending[:n])
+	h.pending.Next(n)
+	h.pendingCount -= count
+	return body, count
+}
+
+// requeue 把失败的消息放回缓存前面
+func (h *httpBackend) requeue(body []byte, count int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.retryAt = time.Now().Add(h.interval)
+	rest := h.pending.Bytes()
+	merged := make([]byte, 0, len(body)+len(rest))
+	merged = append(append(merged, body...), rest...)
+	h.pending.Reset()
+	h.pending.Write(merged)
+	h.pendingCount += count
+	h.trimLocked()
+}
+
+// trimLocked 缓存超过maxBuffer时丢弃最早的消息，调用方持有h.mu
+func (h *httpBackend) trimLocked() {
+	drop := h.pendingCount - h.maxBuffer
+	if drop <= 0 {
+		return
+	}
+	pending := h.pending.Bytes()
+	n := 0
+	for i := 0; i < drop; i++ {
+		n += bytes.IndexByte(pending[n:], '\n') + 1
+	}
+	h.pending.Next(n)
+	h.pendingCount -= drop
+	h.dropped.Add(uint64(drop))
+	internalLog.Printf("http bulk buffer full, oldest messages dropped")
+}
+
+// Dropped returns the number of messages dropped because the bulk buffer was full
+func (h *httpBackend) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+func (h *httpBackend) post(body []byte, compress bool) error {
+	if compress {
+		var err error
+		if body, err = compressPayload(body, CompressionGzip, h.level); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("graylog http input responded %s", resp.Status)
+	}
+	return nil
+}
+
+func (h *httpBackend) SendMessage(message *GELFMessage) error {
+	// a bulk is compressed as a whole, NoCompressKey only applies to single messages
+	message, noCompress := takeNoCompress(message)
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	if h.bulkSize <= 1 {
+		return h.post(data, h.compress && !noCompress)
+	}
+
+	h.mu.Lock()
+	h.pending.Write(data)
+	h.pending.WriteByte('\n')
+	h.pendingCount += 1
+	h.trimLocked()
+	full := h.pendingCount >= h.bulkSize && !time.Now().Before(h.retryAt)
+	h.mu.Unlock()
+
+	if full {
+		return h.flush(h.bulkSize, true)
+	}
+	return nil
+}
+
+// Close sends the buffered messages, later calls return the same error
+func (h *httpBackend) Close() error {
+	h.closeOnce.Do(func() {
+		if h.bulkSize > 1 {
+			close(h.done)
+			h.wg.Wait()
+		}
+		h.closeErr = h.flush(1, false)
+	})
+	return h.closeErr
+}
+
+// concurrencyHint requests use the pooled connections of the client
+func (h *httpBackend) concurrencyHint() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+func (h *httpBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("http backend does not support consuming")
+}
@@ -0,0 +1,95 @@
+package graylog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPBulkCloseTwice(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	backend := NewHTTPBackend(HTTPOptions{URL: server.URL, BulkSize: 10, BulkInterval: time.Hour})
+	if err := backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d requests, want the pending bulk sent once", n)
+	}
+}
+
+func TestHTTPInvalidCompressionLevel(t *testing.T) {
+	backend := NewHTTPBackend(HTTPOptions{URL: "http://127.0.0.1:1/gelf", CompressionLevel: 42})
+	defer backend.Close()
+	if level := backend.(*httpBackend).level; level != gzip.BestSpeed {
+		t.Errorf("level %d kept, want the default %d", level, gzip.BestSpeed)
+	}
+}
+
+func TestHTTPBulkRetry(t *testing.T) {
+	var failures, received atomic.Int64
+	failures.Store(2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := io.ReadAll(body)
+		received.Add(int64(bytes.Count(data, []byte("\n"))))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	backend := NewHTTPBackend(HTTPOptions{URL: server.URL, BulkSize: 2, BulkInterval: 20 * time.Millisecond})
+	defer backend.Close()
+	for i := 0; i < 4; i++ {
+		_ = backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"})
+	}
+	waitFor(t, 5*time.Second, func() bool { return received.Load() == 4 })
+}
+
+func TestHTTPBulkBufferBound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	backend := NewHTTPBackend(HTTPOptions{URL: server.URL, BulkSize: 2, BulkInterval: time.Hour, MaxBulkBuffer: 3})
+	for i := 0; i < 10; i++ {
+		_ = backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"})
+	}
+	h := backend.(*httpBackend)
+	h.mu.Lock()
+	pending := h.pendingCount
+	h.mu.Unlock()
+	if pending > 3 {
+		t.Errorf("%d messages buffered, want at most 3", pending)
+	}
+	if n := h.Dropped(); n != 7 {
+		t.Errorf("%d messages dropped, want 7", n)
+	}
+	if err := backend.Close(); err == nil {
+		t.Error("Close didn't report the messages lost")
+	}
+}
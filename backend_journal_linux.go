@@ -0,0 +1,149 @@
+//go:build linux
+
+package graylog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// JournalSocket path of the journald native protocol socket
+const JournalSocket = "/run/systemd/journal/socket"
+
+type JournalOptions struct {
+	// Identifier value of SYSLOG_IDENTIFIER, default the executable name
+	Identifier string
+	// Socket journald socket path, default JournalSocket
+	Socket string
+}
+
+type journalBackend struct {
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	identifier string
+}
+
+// NewJournalBackend creates a backend writing messages to the systemd journal
+// over its native protocol. Additional fields become journal fields, e.g.
+// _request_id is written as REQUEST_ID and the caller fields as CODE_FILE,
+// CODE_LINE and CODE_FUNC.
+func NewJournalBackend(opts JournalOptions) (Backend, error) {
+	if opts.Socket == "" {
+		opts.Socket = JournalSocket
+	}
+	if opts.Identifier == "" {
+		if exe, err := os.Executable(); err == nil {
+			opts.Identifier = exe[strings.LastIndex(exe, "/")+1:]
+		}
+	}
+	if _, err := os.Stat(opts.Socket); err != nil {
+		return nil, fmt.Errorf("journal socket unavailable: %w", err)
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalBackend{
+		conn:       conn,
+		addr:       &net.UnixAddr{Name: opts.Socket, Net: "unixgram"},
+		identifier: opts.Identifier,
+	}, nil
+}
+
+// journalFieldNames caller fields that have a well-known journal equivalent
+var journalFieldNames = map[string]string{
+	"_caller_file":     "CODE_FILE",
+	"_caller_line":     "CODE_LINE",
+	"_caller_function": "CODE_FUNC",
+}
+
+// journalFieldName converts a GELF additional field name to a journal field
+// name: upper case letters, digits and underscores, not starting with an
+// underscore or a digit
+func journalFieldName(k string) string {
+	if name, ok := journalFieldNames[k]; ok {
+		return name
+	}
+	name := []byte(strings.ToUpper(strings.TrimLeft(k, "_")))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "F_" + string(name)
+	}
+	return string(name)
+}
+
+// writeJournalField 写入一个字段，包含换行的值使用二进制长度格式
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func (j *journalBackend) SendMessage(message *GELFMessage) error {
+	var buf bytes.Buffer
+	text := message.Short
+	if message.Full != "" {
+		text = message.Full
+	}
+	writeJournalField(&buf, "MESSAGE", text)
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(message.Level))
+	if j.identifier != "" {
+		writeJournalField(&buf, "SYSLOG_IDENTIFIER", j.identifier)
+	}
+	for k, v := range message.Extra {
+		writeJournalField(&buf, journalFieldName(k), fmt.Sprint(v))
+	}
+
+	_, _, err := j.conn.WriteMsgUnix(buf.Bytes(), nil, j.addr)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EMSGSIZE) && !errors.Is(err, syscall.ENOBUFS) {
+		return err
+	}
+	return j.sendViaFile(buf.Bytes())
+}
+
+// sendViaFile 消息过大时写入临时文件，通过SCM_RIGHTS传递文件描述符
+func (j *journalBackend) sendViaFile(data []byte) error {
+	f, err := os.CreateTemp("/dev/shm", "journal.")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	_, _, err = j.conn.WriteMsgUnix(nil, rights, j.addr)
+	return err
+}
+
+func (j *journalBackend) Close() error {
+	return j.conn.Close()
+}
+
+func (j *journalBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("journal backend does not support consuming")
+}
@@ -0,0 +1,159 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type LazyOptions struct {
+	// BufferSize maximum number of messages kept until the backend is ready,
+	// later ones are dropped (see Dropped): the first logs of a startup usually
+	// matter most. default 1000
+	BufferSize int
+	// RetryInterval pause between two attempts to create the backend, default 1s
+	RetryInterval time.Duration
+}
+
+var errLazyNotReady = errors.New("backend not ready")
+
+// lazyBackend creates its backend in the background, buffering messages until it is ready
+type lazyBackend struct {
+	opts    LazyOptions
+	mu      sync.Mutex
+	backend Backend
+	buffer  []*GELFMessage
+	// unbuffered 未就绪时发送直接失败，集群节点由加权backend转发到其他节点
+	unbuffered bool
+	dropped    atomic.Uint64
+	ready      chan struct{}
+	done       chan struct{}
+	wg         sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewLazyBackend returns immediately and calls factory in the background until
+// it succeeds, e.g. while DNS or the graylog input isn't reachable yet at boot.
+// Messages sent in the meantime are buffered and flushed in order once the
+// backend is ready, e.g.
+//
+//	NewLazyBackend(func() (Backend, error) { return NewGelfBackend(addr) }, LazyOptions{})
+func NewLazyBackend(factory func() (Backend, error), opts LazyOptions) Backend {
+	return newLazyBackend(factory, opts, false)
+}
+
+func newLazyBackend(factory func() (Backend, error), opts LazyOptions, unbuffered bool) *lazyBackend {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = 1000
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	l := &lazyBackend{
+		opts:       opts,
+		unbuffered: unbuffered,
+		ready:      make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	l.wg.Add(1)
+	go l.connect(factory)
+	return l
+}
+
+// connect 创建backend直到成功，然后按顺序发送缓存的消息
+func (l *lazyBackend) connect(factory func() (Backend, error)) {
+	defer l.wg.Done()
+	var backend Backend
+	for {
+		var err error
+		if backend, err = factory(); err == nil {
+			break
+		}
+		internalLog.Printf("create backend failed: %s\n", err)
+		select {
+		case <-time.After(l.opts.RetryInterval):
+		case <-l.done:
+			return
+		}
+	}
+
+	// 持锁发送缓存，保证新消息排在缓存之后
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.done:
+		_ = backend.Close()
+		return
+	default:
+	}
+	for _, message := range l.buffer {
+		if err := backend.SendMessage(message); err != nil {
+			internalLog.Printf("send buffered message: %v", err)
+		}
+	}
+	l.buffer = nil
+	l.backend = backend
+	close(l.ready)
+}
+
+func (l *lazyBackend) SendMessage(message *GELFMessage) error {
+	l.mu.Lock()
+	if backend := l.backend; backend != nil {
+		l.mu.Unlock()
+		return backend.SendMessage(message)
+	}
+	defer l.mu.Unlock()
+	if l.unbuffered {
+		return errLazyNotReady
+	}
+	if len(l.buffer) >= l.opts.BufferSize {
+		l.dropped.Add(1)
+		return errors.New("backend not ready and startup buffer full")
+	}
+	l.buffer = append(l.buffer, message)
+	return nil
+}
+
+// Dropped returns the number of messages dropped because the buffer was full
+func (l *lazyBackend) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close stops creating the backend, messages still buffered are lost. Later
+// calls return the result of the first
+func (l *lazyBackend) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+		l.closeErr = l.closeBackend()
+	})
+	return l.closeErr
+}
+
+func (l *lazyBackend) closeBackend() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.backend == nil {
+		if len(l.buffer) > 0 {
+			internalLog.Printf("backend never became ready, %d buffered messages lost", len(l.buffer))
+		}
+		return nil
+	}
+	return l.backend.Close()
+}
+
+// LaunchConsume waits for the backend, then consumes from it
+func (l *lazyBackend) LaunchConsume(f func(message *GELFMessage) error) error {
+	select {
+	case <-l.ready:
+	case <-l.done:
+		return errors.New("backend closed before it was ready")
+	}
+	l.mu.Lock()
+	backend := l.backend
+	l.mu.Unlock()
+	return backend.LaunchConsume(f)
+}
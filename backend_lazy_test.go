@@ -0,0 +1,20 @@
+package graylog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLazyCloseTwice(t *testing.T) {
+	created := &closingBackend{}
+	backend := NewLazyBackend(func() (Backend, error) { return created, nil }, LazyOptions{})
+	waitFor(t, time.Second, func() bool { return backend.SendMessage(&GELFMessage{}) == nil && created.count() > 0 })
+	for i := 0; i < 2; i++ {
+		if err := backend.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := created.closes(); n != 1 {
+		t.Errorf("backend closed %d times, want once", n)
+	}
+}
@@ -0,0 +1,80 @@
+package graylog
+
+import (
+	"context"
+	"errors"
+	"path"
+	"time"
+)
+
+const (
+	// PayloadURLKey additional field referencing an offloaded full_message
+	PayloadURLKey = "_payload_url"
+	// PayloadSizeKey additional field with the size of the offloaded full_message
+	PayloadSizeKey = "_payload_size"
+)
+
+// BlobStore stores offloaded message bodies, e.g. an S3 or GCS bucket. Put
+// returns the URL the body can be retrieved from.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) (url string, err error)
+}
+
+type OffloadOptions struct {
+	// Store receives the bodies, required
+	Store BlobStore
+	// Threshold full_message size in bytes above which the body is offloaded, default 32KB
+	Threshold int
+	// KeyPrefix prepended to the object keys, which are <prefix>/<yyyy/mm/dd>/<message id>
+	KeyPrefix string
+	// Timeout bounds each upload, default 10s
+	Timeout time.Duration
+}
+
+// offloadBackend uploads large bodies to a blob store and sends a reference instead
+type offloadBackend struct {
+	Backend
+	opts OffloadOptions
+}
+
+// NewOffloadBackend wraps inner so that messages whose full_message exceeds the
+// threshold are sent with the body replaced by a _payload_url reference. When
+// the upload fails the message is sent unchanged.
+func NewOffloadBackend(inner Backend, opts OffloadOptions) (Backend, error) {
+	if opts.Store == nil {
+		return nil, errors.New("offload backend requires a blob store")
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 32 << 10
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &offloadBackend{Backend: inner, opts: opts}, nil
+}
+
+func (o *offloadBackend) SendMessage(message *GELFMessage) error {
+	if len(message.Full) <= o.opts.Threshold {
+		return o.Backend.SendMessage(message)
+	}
+
+	t := time.Unix(0, int64(message.TimeUnix*float64(time.Second)))
+	key := path.Join(o.opts.KeyPrefix, t.UTC().Format("2006/01/02"), MessageID(message))
+	ctx, cancel := context.WithTimeout(context.Background(), o.opts.Timeout)
+	url, err := o.opts.Store.Put(ctx, key, []byte(message.Full))
+	cancel()
+	if err != nil {
+		internalLog.Printf("offload payload: %v", err)
+		return o.Backend.SendMessage(message)
+	}
+
+	c := *message
+	c.Extra = make(map[string]interface{}, len(message.Extra)+2)
+	for k, v := range message.Extra {
+		c.Extra[k] = v
+	}
+	c.Extra[PayloadURLKey] = url
+	c.Extra[PayloadSizeKey] = len(message.Full)
+	c.Full = ""
+	return o.Backend.SendMessage(&c)
+}
@@ -0,0 +1,153 @@
+package graylog
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PulsarProducer is the part of a pulsar producer used by the pulsar backend.
+// With github.com/apache/pulsar-client-go it is a small adapter:
+//
+//	type producer struct{ pulsar.Producer }
+//
+//	func (p producer) Send(ctx context.Context, key string, payload []byte) error {
+//		_, err := p.Producer.Send(ctx, &pulsar.ProducerMessage{Key: key, Payload: payload})
+//		return err
+//	}
+type PulsarProducer interface {
+	Send(ctx context.Context, key string, payload []byte) error
+	Close()
+}
+
+// PulsarMessage is a message received from pulsar
+type PulsarMessage interface {
+	Payload() []byte
+}
+
+// PulsarConsumer is the part of a pulsar consumer used by LaunchConsume. The
+// consumer should use a key-shared subscription, so that several relays can
+// consume the topic while messages of one key stay in order.
+type PulsarConsumer interface {
+	Receive(ctx context.Context) (PulsarMessage, error)
+	Ack(message PulsarMessage) error
+	Nack(message PulsarMessage)
+	Close()
+}
+
+type PulsarOptions struct {
+	// Producer sends messages to the topic, required to send
+	Producer PulsarProducer
+	// Consumer receives messages from the topic, required by LaunchConsume
+	Consumer PulsarConsumer
+	// Key computes the message key, e.g. RoutingKeyField("tenant"), default the message host
+	Key RoutingKey
+	// SendTimeout bounds each Send call, default 10s
+	SendTimeout time.Duration
+	// CompressionLevel gzip level of the payloads, from gzip.BestSpeed to
+	// gzip.BestCompression, or gzip.HuffmanOnly. default 0 (gzip.BestSpeed),
+	// an invalid level is reported through the internal logger and replaced
+	// by the default
+	CompressionLevel int
+}
+
+type pulsarBackend struct {
+	opts    PulsarOptions
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+	metrics consumerMetrics
+}
+
+// NewPulsarBackend creates a backend producing gzip compressed GELF payloads to
+// a pulsar topic, the client is provided by the caller through PulsarOptions
+func NewPulsarBackend(opts PulsarOptions) Backend {
+	if opts.Key == nil {
+		opts.Key = func(message *GELFMessage) string {
+			return message.Host
+		}
+	}
+	if opts.SendTimeout <= 0 {
+		opts.SendTimeout = 10 * time.Second
+	}
+	if opts.CompressionLevel == 0 {
+		opts.CompressionLevel = gzip.BestSpeed
+	}
+	opts.CompressionLevel = compressionLevelOr("pulsar", CompressionGzip, opts.CompressionLevel, gzip.BestSpeed)
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pulsarBackend{opts: opts, ctx: ctx, cancel: cancel}
+}
+
+func (p *pulsarBackend) SendMessage(message *GELFMessage) error {
+	if p.opts.Producer == nil {
+		return errors.New("pulsar backend has no producer")
+	}
+	payload, err := encodeGzipPayload(message, p.opts.CompressionLevel)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(p.ctx, p.opts.SendTimeout)
+	defer cancel()
+	return p.opts.Producer.Send(ctx, p.opts.Key(message), payload)
+}
+
+func (p *pulsarBackend) Close() error {
+	p.once.Do(func() {
+		p.cancel()
+		if p.opts.Producer != nil {
+			p.opts.Producer.Close()
+		}
+		if p.opts.Consumer != nil {
+			p.opts.Consumer.Close()
+		}
+	})
+	return nil
+}
+
+// LaunchConsume receives messages until Close is called. Messages whose
+// callback fails are negatively acknowledged for redelivery, the ones that
+// can't be decoded are reported and acknowledged since they would never succeed.
+func (p *pulsarBackend) LaunchConsume(f func(message *GELFMessage) error) error {
+	if p.opts.Consumer == nil {
+		return errors.New("pulsar backend has no consumer")
+	}
+	for {
+		msg, err := p.opts.Consumer.Receive(p.ctx)
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		message, err := decodeMessage(msg.Payload())
+		if err != nil {
+			p.metrics.observe(err)
+			// 无法解码的消息重试也不会成功，确认后丢弃
+			internalLog.Printf("pulsar consume error: %v", err)
+			p.ack(msg)
+			continue
+		}
+		err = f(message)
+		p.metrics.observe(err)
+		if err != nil {
+			internalLog.Printf("pulsar consume error: %v", err)
+			p.opts.Consumer.Nack(msg)
+			continue
+		}
+		p.ack(msg)
+	}
+}
+
+func (p *pulsarBackend) ack(msg PulsarMessage) {
+	if err := p.opts.Consumer.Ack(msg); err != nil {
+		internalLog.Printf("pulsar ack error: %v", err)
+	}
+}
+
+// ConsumerStats returns the consumer counters, queue size and lag are left to
+// pulsar's own topic stats
+func (p *pulsarBackend) ConsumerStats() (ConsumerStats, error) {
+	return p.metrics.stats(), nil
+}
@@ -0,0 +1,101 @@
+package graylog
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakePulsarMessage []byte
+
+func (m fakePulsarMessage) Payload() []byte { return m }
+
+// fakePulsarConsumer 依次返回messages，之后阻塞到ctx取消
+type fakePulsarConsumer struct {
+	mu       sync.Mutex
+	messages []PulsarMessage
+	acked    []PulsarMessage
+	nacked   []PulsarMessage
+}
+
+func (c *fakePulsarConsumer) Receive(ctx context.Context) (PulsarMessage, error) {
+	c.mu.Lock()
+	if len(c.messages) > 0 {
+		msg := c.messages[0]
+		c.messages = c.messages[1:]
+		c.mu.Unlock()
+		return msg, nil
+	}
+	c.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *fakePulsarConsumer) Ack(msg PulsarMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acked = append(c.acked, msg)
+	return nil
+}
+
+func (c *fakePulsarConsumer) Nack(msg PulsarMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nacked = append(c.nacked, msg)
+}
+
+func (c *fakePulsarConsumer) Close() {}
+
+func (c *fakePulsarConsumer) settled() (acked, nacked int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.acked), len(c.nacked)
+}
+
+func TestPulsarConsumeDecodeError(t *testing.T) {
+	good, err := encodeGzipPayload(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "ok"}, gzip.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := encodeGzipPayload(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "fail"}, gzip.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := &fakePulsarConsumer{messages: []PulsarMessage{
+		fakePulsarMessage("not a gelf payload"),
+		fakePulsarMessage(good),
+		fakePulsarMessage(failing),
+	}}
+	backend := NewPulsarBackend(PulsarOptions{Consumer: consumer})
+	done := make(chan error, 1)
+	go func() {
+		done <- backend.LaunchConsume(func(message *GELFMessage) error {
+			if message.Short == "fail" {
+				return errors.New("handler failed")
+			}
+			return nil
+		})
+	}()
+	waitFor(t, time.Second, func() bool {
+		acked, nacked := consumer.settled()
+		return acked+nacked == 3
+	})
+	backend.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if acked, nacked := consumer.settled(); acked != 2 || nacked != 1 {
+		t.Errorf("%d acked and %d nacked, want the undecodable and the consumed messages acked", acked, nacked)
+	}
+}
+
+func TestPulsarInvalidCompressionLevel(t *testing.T) {
+	backend := NewPulsarBackend(PulsarOptions{CompressionLevel: 42})
+	defer backend.Close()
+	if level := backend.(*pulsarBackend).opts.CompressionLevel; level != gzip.BestSpeed {
+		t.Errorf("level %d kept, want the default %d", level, gzip.BestSpeed)
+	}
+}
@@ -0,0 +1,112 @@
+package graylog
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RecordingBackend keeps every message in memory instead of sending it, for
+// tests. Use it with a synchronous hook so messages are recorded before the
+// log call returns.
+type RecordingBackend struct {
+	mu       sync.Mutex
+	messages []*GELFMessage
+}
+
+func NewRecordingBackend() *RecordingBackend {
+	return &RecordingBackend{}
+}
+
+func (r *RecordingBackend) SendMessage(message *GELFMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *RecordingBackend) Close() error {
+	return nil
+}
+
+func (r *RecordingBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("recording backend does not support consuming")
+}
+
+// Messages returns a copy of the recorded messages, oldest first
+func (r *RecordingBackend) Messages() []*GELFMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := make([]*GELFMessage, len(r.messages))
+	copy(messages, r.messages)
+	return messages
+}
+
+// LastMessage returns the most recently recorded message, nil if none
+func (r *RecordingBackend) LastMessage() *GELFMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.messages) == 0 {
+		return nil
+	}
+	return r.messages[len(r.messages)-1]
+}
+
+// Reset forgets all recorded messages
+func (r *RecordingBackend) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = nil
+}
+
+// TestingT is the subset of testing.TB used by the assertion helpers
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertLogged reports a test error unless a recorded message has the given
+// level, contains msgSubstring in its short or full message and carries all
+// fields. Field names are given as logged, without the leading underscore.
+func (r *RecordingBackend) AssertLogged(t TestingT, level logrus.Level, msgSubstring string, fields map[string]interface{}) bool {
+	t.Helper()
+	syslogLevel := logrusLevelToSyslog(level)
+	for _, m := range r.Messages() {
+		if m.Level != syslogLevel {
+			continue
+		}
+		if !strings.Contains(m.Short, msgSubstring) && !strings.Contains(m.Full, msgSubstring) {
+			continue
+		}
+		if matchFields(m, fields) {
+			return true
+		}
+	}
+	t.Errorf("no %s message containing %q with fields %v was logged, got %d messages", level, msgSubstring, fields, len(r.Messages()))
+	return false
+}
+
+// AssertNotLogged is the inverse of AssertLogged
+func (r *RecordingBackend) AssertNotLogged(t TestingT, level logrus.Level, msgSubstring string) bool {
+	t.Helper()
+	syslogLevel := logrusLevelToSyslog(level)
+	for _, m := range r.Messages() {
+		if m.Level == syslogLevel && (strings.Contains(m.Short, msgSubstring) || strings.Contains(m.Full, msgSubstring)) {
+			t.Errorf("unexpected %s message logged: %q", level, m.Short)
+			return false
+		}
+	}
+	return true
+}
+
+func matchFields(m *GELFMessage, fields map[string]interface{}) bool {
+	for k, want := range fields {
+		got, ok := extraField(m, k)
+		if !ok || !valuesEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,15 +1,16 @@
 package graylog
 
 import (
-	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 )
 
 var LogQueue = "graylog"
@@ -21,17 +22,120 @@ type RedisOptions struct {
 	DB       int
 	// Workers  asynq maximum number of concurrent processing of tasks. default 100
 	Workers int
+	// Middlewares wrap the message handler used by LaunchConsume, first is outermost,
+	// e.g. for tracing, metrics or panic recovery
+	Middlewares []asynq.MiddlewareFunc
+	// Compression of the task payloads, default CompressionGzip. CompressionZstd
+	// and CompressionSnappy take far less CPU on the producer. Consumers detect
+	// the compression of each task, so producers can be switched one at a time
+	Compression CompressionType
+	// CompressionLevel level of the task payloads. For gzip and zlib from
+	// gzip.BestSpeed to gzip.BestCompression, or gzip.HuffmanOnly, default
+	// gzip.BestCompression. For zstd from 1 to 22, default 3. Ignored by snappy.
+	// An invalid level is reported through the internal logger and replaced by
+	// the default
+	CompressionLevel int
+	// BatchWindow when positive, messages sent within this window are packed
+	// into one task, reducing asynq overhead for chatty services. A failing
+	// message makes the consumer retry its whole batch. default 0 (one task per message)
+	BatchWindow time.Duration
+	// BatchSize maximum number of messages per batch task, default 500
+	BatchSize int
+	// ConsumerID identifies this consumer among the replicas consuming the
+	// queue, LaunchConsume fails while another consumer with the same id is
+	// active. default hostname:pid
+	ConsumerID string
+	// HeartbeatInterval how often a consumer refreshes its entry in
+	// ConsumersKey, it is considered gone after three missed heartbeats. default 5s
+	HeartbeatInterval time.Duration
+	// MaxInFlight maximum number of messages handed to the LaunchConsume
+	// callback at once, batch tasks included, e.g. to protect what the
+	// callback writes to. default 0 (Workers tasks at once)
+	MaxInFlight int
+	// RoutingKey selects the queue of a message, e.g. RoutingKeyField("tenant"):
+	// messages with a key k listed in RoutingKeys are queued in LogQueue:k, the
+	// others in LogQueue. default nil (every message in LogQueue)
+	RoutingKey RoutingKey
+	// RoutingKeys keys whose queues LaunchConsume processes besides LogQueue,
+	// with the same priority. Senders and consumers must list the same keys
+	RoutingKeys []string
 }
 
+// queueName asynq queue of a routing key
+func queueName(key string) string {
+	if key == "" {
+		return LogQueue
+	}
+	return LogQueue + ":" + key
+}
+
+// queues queues processed by LaunchConsume and counted by ConsumerStats
+func (r *redisBackend) queues() []string {
+	queues := []string{LogQueue}
+	for _, key := range r.opts.RoutingKeys {
+		queues = append(queues, queueName(key))
+	}
+	return queues
+}
+
+// queueOf queue a message is sent to, keys without a consumed queue fall back to LogQueue
+func (r *redisBackend) queueOf(message *GELFMessage) string {
+	if r.opts.RoutingKey == nil {
+		return LogQueue
+	}
+	key := r.opts.RoutingKey(message)
+	if !r.routed[key] {
+		return LogQueue
+	}
+	return queueName(key)
+}
+
+const (
+	taskTypeMessage = "gelf_message"
+	taskTypeBatch   = "gelf_batch"
+)
+
 type redisBackend struct {
-	client *asynq.Client
-	server *asynq.Server
+	opts RedisOptions
+	// routed RoutingKeys的集合
+	routed    map[string]bool
+	client    *asynq.Client
+	server    *asynq.Server
+	inspector *asynq.Inspector
+	metrics   consumerMetrics
+	// rdb 心跳使用的redis连接
+	rdb redis.UniversalClient
+
+	batchMu sync.Mutex
+	batch   []*GELFMessage
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 func NewRedisBackend(opts RedisOptions) Backend {
 	if opts.Workers <= 0 {
 		opts.Workers = 100
 	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.ConsumerID == "" {
+		opts.ConsumerID = defaultConsumerID()
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = 5 * time.Second
+	}
+	level := gzip.BestCompression
+	if opts.Compression == CompressionZstd {
+		level = 3
+	}
+	if opts.CompressionLevel == 0 {
+		opts.CompressionLevel = level
+	}
+	opts.CompressionLevel = compressionLevelOr("redis", opts.Compression, opts.CompressionLevel, level)
 	redisClientOpt := asynq.RedisClientOpt{
 		Addr:     opts.Addr,
 		Username: opts.Username,
@@ -40,76 +144,237 @@ func NewRedisBackend(opts RedisOptions) Backend {
 	}
 	client := asynq.NewClient(redisClientOpt)
 
+	queues := map[string]int{LogQueue: 10}
+	routed := make(map[string]bool, len(opts.RoutingKeys))
+	for _, key := range opts.RoutingKeys {
+		queues[queueName(key)] = 10
+		routed[key] = key != ""
+	}
 	server := asynq.NewServer(redisClientOpt, asynq.Config{
 		Concurrency: opts.Workers,
-		Queues:      map[string]int{LogQueue: 10},
+		Queues:      queues,
 		ErrorHandler: asynq.ErrorHandlerFunc(func(ctx context.Context, task *asynq.Task, err error) {
-			fmt.Printf("Error: %v\n", err)
+			internalLog.Printf("Error: %v\n", err)
 		}),
 	})
 
-	return &redisBackend{
-		client: client,
-		server: server,
+	backend := &redisBackend{
+		opts:      opts,
+		routed:    routed,
+		client:    client,
+		server:    server,
+		inspector: asynq.NewInspector(redisClientOpt),
+		rdb:       redisClientOpt.MakeRedisClient().(redis.UniversalClient),
+		done:      make(chan struct{}),
 	}
+	if opts.BatchWindow > 0 {
+		backend.wg.Add(1)
+		go backend.batchLoop()
+	}
+	return backend
 }
 
 func (r *redisBackend) SendMessage(message *GELFMessage) error {
-	data, err := json.Marshal(message)
-	if err != nil {
-		return err
+	if r.opts.BatchWindow > 0 {
+		r.batchMu.Lock()
+		r.batch = append(r.batch, message)
+		full := len(r.batch) >= r.opts.BatchSize
+		r.batchMu.Unlock()
+		if full {
+			return r.flushBatch()
+		}
+		return nil
 	}
 
-	// 压缩
-	var buf bytes.Buffer
-	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	payload, err := encodePayload(message, r.opts.Compression, r.opts.CompressionLevel)
 	if err != nil {
 		return err
 	}
+	r.enqueue(r.queueOf(message), taskTypeMessage, payload)
+	return nil
+}
 
-	if _, err = zw.Write(data); err != nil {
-		return err
-	}
-	// ensure all data is written
-	_ = zw.Close()
-
+// enqueue 入队直到成功
+func (r *redisBackend) enqueue(queue, taskType string, payload []byte) {
 	for {
-		if _, err := r.client.Enqueue(asynq.NewTask("gelf_message", buf.Bytes()), asynq.Queue(LogQueue)); err != nil {
-			fmt.Printf("enqueue error: %v\n", err)
+		if _, err := r.client.Enqueue(asynq.NewTask(taskType, payload), asynq.Queue(queue)); err != nil {
+			internalLog.Printf("enqueue error: %v\n", err)
 			time.Sleep(time.Second)
 			continue
 		}
+		return
+	}
+}
+
+func (r *redisBackend) batchLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.opts.BatchWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.flushBatch(); err != nil {
+				internalLog.Printf("redis batch flush error: %v", err)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// flushBatch 将缓存的消息按队列打包为任务入队
+func (r *redisBackend) flushBatch() error {
+	r.batchMu.Lock()
+	batch := r.batch
+	r.batch = nil
+	r.batchMu.Unlock()
+	if len(batch) == 0 {
 		return nil
 	}
+
+	var queues []string
+	batches := make(map[string][]*GELFMessage)
+	for _, message := range batch {
+		queue := r.queueOf(message)
+		if _, ok := batches[queue]; !ok {
+			queues = append(queues, queue)
+		}
+		batches[queue] = append(batches[queue], message)
+	}
+	var errs []error
+	for _, queue := range queues {
+		payload, err := encodePayload(batches[queue], r.opts.Compression, r.opts.CompressionLevel)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.enqueue(queue, taskTypeBatch, payload)
+	}
+	return errors.Join(errs...)
 }
 
+// Close flushes the batch and closes the connections, later calls return the same error
 func (r *redisBackend) Close() error {
-	return r.client.Close()
+	r.closeOnce.Do(func() {
+		if r.opts.BatchWindow > 0 {
+			close(r.done)
+			r.wg.Wait()
+			if err := r.flushBatch(); err != nil {
+				internalLog.Printf("redis batch flush error: %v", err)
+			}
+		}
+		_ = r.inspector.Close()
+		_ = r.rdb.Close()
+		r.closeErr = r.client.Close()
+	})
+	return r.closeErr
 }
 
-func (r *redisBackend) LaunchConsume(f func(message *GELFMessage) error) error {
-	mux := asynq.NewServeMux()
-	mux.HandleFunc("gelf_message", func(ctx context.Context, task *asynq.Task) error {
-		// 解压
-		zr, err := gzip.NewReader(bytes.NewReader(task.Payload()))
+// ConsumerStats returns the consumer counters and the current queue backlog
+func (r *redisBackend) ConsumerStats() (ConsumerStats, error) {
+	stats := r.metrics.stats()
+	existing := map[string]bool{LogQueue: true}
+	if len(r.opts.RoutingKeys) > 0 {
+		names, err := r.inspector.Queues()
 		if err != nil {
-			return err
+			return stats, err
+		}
+		for _, name := range names {
+			existing[name] = true
 		}
-		data, err := io.ReadAll(zr)
+	}
+	for _, queue := range r.queues() {
+		if !existing[queue] {
+			// nothing routed to it yet
+			continue
+		}
+		info, err := r.inspector.GetQueueInfo(queue)
 		if err != nil {
-			return err
+			return stats, err
 		}
-
-		var gelfMessage GELFMessage
-		if err := json.Unmarshal(data, &gelfMessage); err != nil {
-			return err
+		stats.QueueSize += info.Pending + info.Retry + info.Scheduled
+		if info.Latency > stats.QueueLag {
+			stats.QueueLag = info.Latency
 		}
+	}
+	return stats, nil
+}
 
-		if err := f(&gelfMessage); err != nil {
-			return err
+// concurrencyHint enqueues use the pooled connections of the client
+func (r *redisBackend) concurrencyHint() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+func (r *redisBackend) LaunchConsume(f func(message *GELFMessage) error) error {
+	if err := r.register(context.Background()); err != nil {
+		return err
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go r.heartbeat(stop, stopped)
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	f = r.limitInFlight(f)
+	mux := asynq.NewServeMux()
+	mux.Use(r.opts.Middlewares...)
+	mux.HandleFunc(taskTypeMessage, func(ctx context.Context, task *asynq.Task) error {
+		if retried, ok := asynq.GetRetryCount(ctx); ok && retried > 0 {
+			r.metrics.retried.Add(1)
 		}
-		return nil
+		err := handleGelfTask(task, f)
+		r.metrics.observe(err)
+		return err
+	})
+	mux.HandleFunc(taskTypeBatch, func(ctx context.Context, task *asynq.Task) error {
+		if retried, ok := asynq.GetRetryCount(ctx); ok && retried > 0 {
+			r.metrics.retried.Add(1)
+		}
+		return r.handleBatchTask(task, f)
 	})
 
 	return r.server.Run(mux)
 }
+
+func handleGelfTask(task *asynq.Task, f func(message *GELFMessage) error) error {
+	// 解压
+	data, err := DecodePayload(task.Payload())
+	if err != nil {
+		return err
+	}
+
+	var gelfMessage GELFMessage
+	if err := json.Unmarshal(data, &gelfMessage); err != nil {
+		return err
+	}
+	NormalizeMessage(&gelfMessage)
+
+	return f(&gelfMessage)
+}
+
+// handleBatchTask 解包批量任务，逐条处理；有失败时返回错误，整个批次重试
+func (r *redisBackend) handleBatchTask(task *asynq.Task, f func(message *GELFMessage) error) error {
+	data, err := DecodePayload(task.Payload())
+	if err != nil {
+		r.metrics.observe(err)
+		return err
+	}
+
+	var messages []*GELFMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		r.metrics.observe(err)
+		return err
+	}
+
+	var errs []error
+	for _, message := range messages {
+		NormalizeMessage(message)
+		err := f(message)
+		r.metrics.observe(err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,59 @@
+package graylog
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+)
+
+func TestRedisRoutingKeyFallback(t *testing.T) {
+	mr := miniredis.RunT(t)
+	backend := NewRedisBackend(RedisOptions{
+		Addr:        mr.Addr(),
+		RoutingKey:  RoutingKeyField("tenant"),
+		RoutingKeys: []string{"a"},
+	})
+	defer backend.Close()
+
+	for _, tenant := range []string{"a", "b", ""} {
+		m := &GELFMessage{Version: GELFVersion11, Host: "h", Short: "s", Extra: map[string]interface{}{"_tenant": tenant}}
+		if err := backend.SendMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{Addr: mr.Addr()})
+	defer inspector.Close()
+	for queue, want := range map[string]int{LogQueue + ":a": 1, LogQueue: 2} {
+		info, err := inspector.GetQueueInfo(queue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Pending != want {
+			t.Errorf("%s has %d messages, want %d", queue, info.Pending, want)
+		}
+	}
+	queues, err := inspector.Queues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, queue := range queues {
+		if queue == LogQueue+":b" {
+			t.Fatal("unconsumed queue LogQueue:b created")
+		}
+	}
+}
+
+func TestRedisInvalidCompressionLevel(t *testing.T) {
+	mr := miniredis.RunT(t)
+	backend := NewRedisBackend(RedisOptions{Addr: mr.Addr(), Compression: CompressionZstd, CompressionLevel: 30})
+	defer backend.Close()
+	if level := backend.(*redisBackend).opts.CompressionLevel; level != 3 {
+		t.Errorf("level %d kept, want the zstd default 3", level)
+	}
+	m := &GELFMessage{Version: GELFVersion11, Host: "h", Short: "s"}
+	if err := backend.SendMessage(m); err != nil {
+		t.Fatal(err)
+	}
+}
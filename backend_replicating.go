@@ -0,0 +1,83 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// replicatingBackend sends to a primary and mirrors to a standby in the background
+type replicatingBackend struct {
+	primary Backend
+	standby Backend
+	ch      chan *GELFMessage
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// NewReplicatingBackend returns a backend sending every message to primary and
+// mirroring it, best-effort, to standby, so a switchover to the standby
+// graylog cluster has recent history. Only primary errors are returned; when
+// the standby falls behind by more than bufferSize messages, mirrored copies
+// are dropped (see Dropped). default bufferSize 10000
+func NewReplicatingBackend(primary, standby Backend, bufferSize int) Backend {
+	if bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	r := &replicatingBackend{
+		primary: primary,
+		standby: standby,
+		ch:      make(chan *GELFMessage, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go r.mirror()
+	return r
+}
+
+func (r *replicatingBackend) mirror() {
+	defer close(r.done)
+	for message := range r.ch {
+		if err := r.standby.SendMessage(message); err != nil {
+			internalLog.Printf("standby backend: %v", err)
+		}
+	}
+}
+
+func (r *replicatingBackend) SendMessage(message *GELFMessage) error {
+	err := r.primary.SendMessage(message)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return err
+	}
+	select {
+	case r.ch <- message:
+	default:
+		r.dropped.Add(1)
+	}
+	return err
+}
+
+// Dropped returns the number of messages not mirrored because the standby fell behind
+func (r *replicatingBackend) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+func (r *replicatingBackend) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.ch)
+	}
+	r.mu.Unlock()
+	<-r.done
+	return errors.Join(r.primary.Close(), r.standby.Close())
+}
+
+// LaunchConsume consumes from the primary
+func (r *replicatingBackend) LaunchConsume(f func(message *GELFMessage) error) error {
+	return r.primary.LaunchConsume(f)
+}
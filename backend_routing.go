@@ -0,0 +1,294 @@
+package graylog
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RouteFunc returns the backend a message is sent to, nil drops the message
+type RouteFunc func(message *GELFMessage) Backend
+
+// routingBackend sends each message to the backend chosen by its route
+type routingBackend struct {
+	route    RouteFunc
+	backends []Backend
+}
+
+// NewRoutingBackend returns a backend sending each message to the backend
+// returned by route, e.g. errors to a gelf tcp backend and the rest to a
+// redis backend, see RouteByLevel. backends are the backends route may return,
+// they are closed by Close.
+func NewRoutingBackend(route RouteFunc, backends ...Backend) Backend {
+	return &routingBackend{route: route, backends: backends}
+}
+
+// RouteByLevel routes the messages of syslog level maxLevel or more severe,
+// e.g. LogErr, to severe and the others to other
+func RouteByLevel(maxLevel int32, severe, other Backend) RouteFunc {
+	return func(message *GELFMessage) Backend {
+		if message.Level <= maxLevel {
+			return severe
+		}
+		return other
+	}
+}
+
+// RouteByField routes messages by the value of an additional field, e.g.
+// "_tenant", to the backend of routes for that value, and the others to
+// fallback. A field name without the leading underscore is accepted
+func RouteByField(field string, routes map[string]Backend, fallback Backend) RouteFunc {
+	key := RoutingKeyField(field)
+	return func(message *GELFMessage) Backend {
+		if backend, ok := routes[key(message)]; ok {
+			return backend
+		}
+		return fallback
+	}
+}
+
+func fieldKey(field string) string {
+	if strings.HasPrefix(field, "_") {
+		return field
+	}
+	return "_" + field
+}
+
+// fieldValue value of an additional field as a string, "" when missing
+func fieldValue(message *GELFMessage, key string) string {
+	v, ok := message.Extra[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func (r *routingBackend) SendMessage(message *GELFMessage) error {
+	backend := r.route(message)
+	if backend == nil {
+		return nil
+	}
+	return backend.SendMessage(message)
+}
+
+func (r *routingBackend) Close() error {
+	var errs []error
+	for _, backend := range r.backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *routingBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("routing backend does not support consuming")
+}
+
+// FieldRoutingOptions options of NewFieldRoutingBackendWithOptions
+type FieldRoutingOptions struct {
+	// MaxBackends maximum number of backends kept, the least recently used
+	// one is closed beyond it. default 1000
+	MaxBackends int
+	// RetryInterval how long the failure to create the backend of a value is
+	// returned to its messages before creating it again. default 10s
+	RetryInterval time.Duration
+}
+
+// fieldRoute 一个值的backend，ready关闭后backend或err可用
+type fieldRoute struct {
+	value    string
+	ready    chan struct{}
+	backend  Backend
+	err      error
+	failedAt time.Time
+	elem     *list.Element
+	// refs 正在使用的发送数；evicted 已移出缓存，最后一个使用者关闭backend
+	refs    int
+	evicted bool
+}
+
+// fieldRoutingBackend creates a backend per value of a field on demand
+type fieldRoutingBackend struct {
+	key        string
+	newBackend func(value string) (Backend, error)
+	fallback   Backend
+	opts       FieldRoutingOptions
+	mu         sync.Mutex
+	routes     map[string]*fieldRoute
+	// lru 最近使用的在前
+	lru    *list.List
+	closed bool
+}
+
+// NewFieldRoutingBackend returns a backend routing messages by the value of an
+// additional field with the default FieldRoutingOptions, see
+// NewFieldRoutingBackendWithOptions
+func NewFieldRoutingBackend(field string, newBackend func(value string) (Backend, error), fallback Backend) Backend {
+	return NewFieldRoutingBackendWithOptions(field, newBackend, fallback, FieldRoutingOptions{})
+}
+
+// NewFieldRoutingBackendWithOptions returns a backend routing messages by the
+// value of an additional field, e.g. "_tenant", when the values aren't known
+// in advance: the backend of a value, e.g. a gelf backend to the input of the
+// tenant, is created by newBackend for its first message and reused
+// afterwards. Backends are created outside of any lock, once per value, so a
+// slow one only delays the messages of its value. Messages without the field
+// go to fallback, which may be nil to drop them. Close closes every backend
+// created.
+func NewFieldRoutingBackendWithOptions(field string, newBackend func(value string) (Backend, error), fallback Backend, opts FieldRoutingOptions) Backend {
+	if opts.MaxBackends <= 0 {
+		opts.MaxBackends = 1000
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 10 * time.Second
+	}
+	return &fieldRoutingBackend{
+		key:        fieldKey(field),
+		newBackend: newBackend,
+		fallback:   fallback,
+		opts:       opts,
+		routes:     make(map[string]*fieldRoute),
+		lru:        list.New(),
+	}
+}
+
+// acquire 返回value对应的route，第一次使用时在锁外创建backend，同一个值只创建一次
+func (f *fieldRoutingBackend) acquire(value string) (*fieldRoute, error) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil, errors.New("field routing backend is closed")
+	}
+	r, ok := f.routes[value]
+	if ok && r.err != nil && time.Since(r.failedAt) >= f.opts.RetryInterval {
+		// 创建失败已过重试间隔，重新创建
+		f.remove(r)
+		ok = false
+	}
+	if ok {
+		f.lru.MoveToFront(r.elem)
+		r.refs++
+		f.mu.Unlock()
+		<-r.ready
+		if r.err != nil {
+			f.release(r)
+			return nil, r.err
+		}
+		return r, nil
+	}
+
+	r = &fieldRoute{value: value, ready: make(chan struct{}), refs: 1}
+	r.elem = f.lru.PushFront(r)
+	f.routes[value] = r
+	var evicted []Backend
+	for f.lru.Len() > f.opts.MaxBackends {
+		if backend := f.remove(f.lru.Back().Value.(*fieldRoute)); backend != nil {
+			evicted = append(evicted, backend)
+		}
+	}
+	f.mu.Unlock()
+	closeBackends(evicted)
+
+	backend, err := f.newBackend(value)
+	f.mu.Lock()
+	if err != nil {
+		r.err = fmt.Errorf("create backend for %s=%s: %w", f.key, value, err)
+		r.failedAt = time.Now()
+	} else {
+		r.backend = backend
+	}
+	close(r.ready)
+	f.mu.Unlock()
+	if err != nil {
+		f.release(r)
+		return nil, r.err
+	}
+	return r, nil
+}
+
+// remove 移出缓存，返回可以立即关闭的backend。调用时持有mu
+func (f *fieldRoutingBackend) remove(r *fieldRoute) Backend {
+	if r.evicted {
+		return nil
+	}
+	r.evicted = true
+	delete(f.routes, r.value)
+	f.lru.Remove(r.elem)
+	if r.refs > 0 {
+		return nil
+	}
+	return r.backend
+}
+
+// release 发送结束，已移出缓存的route由最后一个使用者关闭
+func (f *fieldRoutingBackend) release(r *fieldRoute) {
+	f.mu.Lock()
+	r.refs--
+	var backend Backend
+	if r.evicted && r.refs == 0 {
+		backend = r.backend
+	}
+	f.mu.Unlock()
+	if backend != nil {
+		closeBackends([]Backend{backend})
+	}
+}
+
+func closeBackends(backends []Backend) {
+	for _, backend := range backends {
+		if err := backend.Close(); err != nil {
+			internalLog.Printf("close routed backend: %v", err)
+		}
+	}
+}
+
+func (f *fieldRoutingBackend) SendMessage(message *GELFMessage) error {
+	value := fieldValue(message, f.key)
+	if value == "" {
+		if f.fallback == nil {
+			return nil
+		}
+		return f.fallback.SendMessage(message)
+	}
+	r, err := f.acquire(value)
+	if err != nil {
+		return err
+	}
+	defer f.release(r)
+	return r.backend.SendMessage(message)
+}
+
+// Close closes the backends not in use, those in use are closed when their
+// sends return
+func (f *fieldRoutingBackend) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	var backends []Backend
+	for _, r := range f.routes {
+		if backend := f.remove(r); backend != nil {
+			backends = append(backends, backend)
+		}
+	}
+	f.mu.Unlock()
+
+	var errs []error
+	for _, backend := range backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if f.fallback != nil {
+		if err := f.fallback.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *fieldRoutingBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("field routing backend does not support consuming")
+}
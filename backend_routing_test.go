@@ -0,0 +1,135 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closingBackend records whether it was closed
+type closingBackend struct {
+	stubBackend
+	closed     atomic.Bool
+	closeCount atomic.Int64
+}
+
+func (c *closingBackend) Close() error {
+	c.closed.Store(true)
+	c.closeCount.Add(1)
+	return nil
+}
+
+func (c *closingBackend) closes() int64 {
+	return c.closeCount.Load()
+}
+
+func tenantMessage(tenant string) *GELFMessage {
+	return &GELFMessage{Extra: map[string]interface{}{"_tenant": tenant}}
+}
+
+func TestFieldRoutingSlowBackend(t *testing.T) {
+	release := make(chan struct{})
+	var created sync.Map
+	var creations atomic.Int64
+	f := NewFieldRoutingBackend("tenant", func(value string) (Backend, error) {
+		creations.Add(1)
+		if value == "slow" {
+			<-release
+		}
+		b := &closingBackend{}
+		created.Store(value, b)
+		return b, nil
+	}, nil)
+	defer f.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f.SendMessage(tenantMessage("slow")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// the other tenants aren't held up by the slow one
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := f.SendMessage(tenantMessage("fast")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("fast tenant blocked by the slow one")
+	}
+	close(release)
+	wg.Wait()
+
+	if n := creations.Load(); n != 2 {
+		t.Fatalf("%d backends created, want one per tenant", n)
+	}
+	slow, _ := created.Load("slow")
+	if n := slow.(*closingBackend).count(); n != 10 {
+		t.Fatalf("slow tenant got %d messages, want 10", n)
+	}
+}
+
+func TestFieldRoutingCachedFailure(t *testing.T) {
+	var creations atomic.Int64
+	f := NewFieldRoutingBackendWithOptions("tenant", func(value string) (Backend, error) {
+		creations.Add(1)
+		return nil, errors.New("unreachable")
+	}, nil, FieldRoutingOptions{RetryInterval: 50 * time.Millisecond})
+	defer f.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := f.SendMessage(tenantMessage("a")); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if n := creations.Load(); n != 1 {
+		t.Fatalf("creation tried %d times, want once per retry interval", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	_ = f.SendMessage(tenantMessage("a"))
+	if n := creations.Load(); n != 2 {
+		t.Fatalf("creation tried %d times after the retry interval, want 2", n)
+	}
+}
+
+func TestFieldRoutingEviction(t *testing.T) {
+	backends := map[string]*closingBackend{}
+	f := NewFieldRoutingBackendWithOptions("tenant", func(value string) (Backend, error) {
+		b := &closingBackend{}
+		backends[value] = b
+		return b, nil
+	}, nil, FieldRoutingOptions{MaxBackends: 2})
+
+	for _, tenant := range []string{"a", "b", "a", "c"} {
+		if err := f.SendMessage(tenantMessage(tenant)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b was the least recently used
+	if !backends["b"].closed.Load() || backends["a"].closed.Load() || backends["c"].closed.Load() {
+		t.Fatalf("closed a=%v b=%v c=%v, want only b", backends["a"].closed.Load(), backends["b"].closed.Load(), backends["c"].closed.Load())
+	}
+	if err := f.SendMessage(tenantMessage("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for tenant, b := range backends {
+		if !b.closed.Load() {
+			t.Errorf("backend of %s not closed", tenant)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package graylog
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// shardingBackend sends the messages of a routing key always to the same backend
+type shardingBackend struct {
+	key      RoutingKey
+	backends []Backend
+}
+
+// NewShardingBackend returns a backend spreading messages over backends by
+// the hash of their routing key, so that the messages of a key, e.g. a tenant,
+// always go to the same backend and stay in order. default key the message host
+func NewShardingBackend(key RoutingKey, backends ...Backend) Backend {
+	if key == nil {
+		key = func(message *GELFMessage) string {
+			return message.Host
+		}
+	}
+	return &shardingBackend{key: key, backends: backends}
+}
+
+func (s *shardingBackend) SendMessage(message *GELFMessage) error {
+	if len(s.backends) == 0 {
+		return errors.New("sharding backend has no backends")
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s.key(message)))
+	return s.backends[h.Sum32()%uint32(len(s.backends))].SendMessage(message)
+}
+
+func (s *shardingBackend) Close() error {
+	var errs []error
+	for _, backend := range s.backends {
+		if err := backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *shardingBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("sharding backend does not support consuming")
+}
@@ -0,0 +1,102 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+type teeTarget struct {
+	backend Backend
+	ch      chan *GELFMessage
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// teeBackend duplicates every message to its targets, each with its own buffer
+type teeBackend struct {
+	targets []*teeTarget
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// NewTeeBackend returns a backend duplicating every message to all backends,
+// e.g. graylog and an archive. Unlike NewFanoutBackend each backend is fed
+// from its own buffer of bufferSize messages by its own goroutine, so a slow
+// backend doesn't stall the others nor the caller: when its buffer is full,
+// its copies are dropped (see Dropped). Send errors are reported through the
+// internal logger. default bufferSize 10000
+func NewTeeBackend(backends []Backend, bufferSize int) Backend {
+	if bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	t := &teeBackend{}
+	for _, backend := range backends {
+		target := &teeTarget{
+			backend: backend,
+			ch:      make(chan *GELFMessage, bufferSize),
+			done:    make(chan struct{}),
+		}
+		t.targets = append(t.targets, target)
+		go target.run()
+	}
+	return t
+}
+
+func (t *teeTarget) run() {
+	defer close(t.done)
+	for message := range t.ch {
+		if err := t.backend.SendMessage(message); err != nil {
+			internalLog.Printf("tee backend %T: %v", t.backend, err)
+		}
+	}
+}
+
+func (t *teeBackend) SendMessage(message *GELFMessage) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return errors.New("tee backend is closed")
+	}
+	for _, target := range t.targets {
+		select {
+		case target.ch <- message:
+		default:
+			target.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Dropped returns, by backend, the number of copies dropped because it fell behind
+func (t *teeBackend) Dropped() []uint64 {
+	dropped := make([]uint64, len(t.targets))
+	for i, target := range t.targets {
+		dropped[i] = target.dropped.Load()
+	}
+	return dropped
+}
+
+// Close sends the buffered messages, then closes the backends
+func (t *teeBackend) Close() error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		for _, target := range t.targets {
+			close(target.ch)
+		}
+	}
+	t.mu.Unlock()
+	var errs []error
+	for _, target := range t.targets {
+		<-target.done
+		if err := target.backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *teeBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("tee backend does not support consuming")
+}
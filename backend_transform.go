@@ -0,0 +1,35 @@
+package graylog
+
+// TransformFunc maps a message before it is sent. Returning false drops the message.
+type TransformFunc func(message *GELFMessage) (*GELFMessage, bool)
+
+// transformBackend applies transformations to every message before delegating
+type transformBackend struct {
+	Backend
+	fns []TransformFunc
+}
+
+// TransformBackend wraps inner so that every message goes through fns, in
+// order, before being sent. A function returning false drops the message and
+// the remaining functions are skipped.
+func TransformBackend(inner Backend, fns ...TransformFunc) Backend {
+	return &transformBackend{Backend: inner, fns: fns}
+}
+
+func (t *transformBackend) apply(message *GELFMessage) (*GELFMessage, bool) {
+	for _, fn := range t.fns {
+		var ok bool
+		if message, ok = fn(message); !ok || message == nil {
+			return nil, false
+		}
+	}
+	return message, true
+}
+
+func (t *transformBackend) SendMessage(message *GELFMessage) error {
+	message, ok := t.apply(message)
+	if !ok {
+		return nil
+	}
+	return t.Backend.SendMessage(message)
+}
@@ -0,0 +1,207 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// WeightedTarget a backend of NewWeightedBackend
+type WeightedTarget struct {
+	Backend Backend
+	// Weight share of the messages sent to this backend, default 1
+	Weight int
+}
+
+// WeightedOptions options of NewWeightedBackendWithOptions
+type WeightedOptions struct {
+	// FailureThreshold consecutive failures after which a backend is marked
+	// down and skipped, default 1
+	FailureThreshold int
+	// RetryInterval how long a down backend is skipped. The next message
+	// after it probes the backend, which is back in rotation when the send
+	// succeeds and skipped for another interval otherwise. default 10s
+	RetryInterval time.Duration
+	// OnHealthChange is called when a backend, by its index, is marked down
+	// or recovers
+	OnHealthChange func(index int, healthy bool)
+}
+
+type weightedTarget struct {
+	index   int
+	backend Backend
+	weight  int
+	// effective 出错时减半，之后每轮选择恢复1，直到weight
+	effective int
+	current   int
+	failures  int
+	// retryAt 非零时目标已停用，到时间后由一条消息探测；probing 探测进行中
+	retryAt time.Time
+	probing bool
+}
+
+// weightedBackend spreads messages over its targets by smooth weighted round-robin
+type weightedBackend struct {
+	opts    WeightedOptions
+	mu      sync.Mutex
+	targets []*weightedTarget
+	// manual 停用的目标不用消息探测，也不作为最后的尝试，由setHealthy恢复
+	manual bool
+}
+
+// NewWeightedBackend returns a backend spreading messages over several
+// backends, e.g. graylog nodes, in proportion to their weights, with the
+// default WeightedOptions
+func NewWeightedBackend(targets ...WeightedTarget) Backend {
+	return NewWeightedBackendWithOptions(WeightedOptions{}, targets...)
+}
+
+// NewWeightedBackendWithOptions returns a backend spreading messages over
+// several backends in proportion to their weights. A failing backend has its
+// weight halved, shifting traffic away from a degraded node, and regains it
+// gradually as it keeps being picked. After FailureThreshold consecutive
+// failures it is skipped until a probe succeeds, see RetryInterval. A message
+// that fails is tried on the other backends, the down ones last, before an
+// error is returned.
+func NewWeightedBackendWithOptions(opts WeightedOptions, targets ...WeightedTarget) Backend {
+	return newWeightedBackend(opts, targets)
+}
+
+func newWeightedBackend(opts WeightedOptions, targets []WeightedTarget) *weightedBackend {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 1
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 10 * time.Second
+	}
+	w := &weightedBackend{opts: opts}
+	for i, t := range targets {
+		if t.Weight <= 0 {
+			t.Weight = 1
+		}
+		w.targets = append(w.targets, &weightedTarget{
+			index:     i,
+			backend:   t.Backend,
+			weight:    t.Weight,
+			effective: t.Weight,
+		})
+	}
+	return w
+}
+
+// pick 到期的停用目标先用一条消息探测，否则在可用目标间平滑加权轮询，
+// 跳过已尝试的目标；可用目标都已尝试时返回停用的目标
+func (w *weightedBackend) pick(tried map[*weightedTarget]bool, now time.Time) *weightedTarget {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.manual {
+		for _, t := range w.targets {
+			if !tried[t] && !t.retryAt.IsZero() && !t.probing && !now.Before(t.retryAt) {
+				t.probing = true
+				return t
+			}
+		}
+	}
+
+	var best *weightedTarget
+	total := 0
+	for _, t := range w.targets {
+		if tried[t] || !t.retryAt.IsZero() {
+			continue
+		}
+		t.current += t.effective
+		total += t.effective
+		if t.effective < t.weight {
+			t.effective++
+		}
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	if best != nil {
+		best.current -= total
+		return best
+	}
+
+	if !w.manual {
+		for _, t := range w.targets {
+			if !tried[t] {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// observe 记录发送结果，连续失败达到阈值时停用目标
+func (w *weightedBackend) observe(t *weightedTarget, err error) {
+	w.mu.Lock()
+	wasHealthy := t.retryAt.IsZero()
+	t.probing = false
+	if err == nil {
+		t.failures = 0
+		t.retryAt = time.Time{}
+	} else {
+		t.failures++
+		t.effective /= 2
+		if !wasHealthy || t.failures >= w.opts.FailureThreshold {
+			t.retryAt = time.Now().Add(w.opts.RetryInterval)
+		}
+	}
+	healthy := t.retryAt.IsZero()
+	w.mu.Unlock()
+
+	if healthy != wasHealthy && w.opts.OnHealthChange != nil {
+		w.opts.OnHealthChange(t.index, healthy)
+	}
+}
+
+// setDown setHealthy 由外部(如后台重连)标记目标的状态
+func (w *weightedBackend) setDown(index int, err error) {
+	t := w.targets[index]
+	w.mu.Lock()
+	t.failures = w.opts.FailureThreshold - 1
+	w.mu.Unlock()
+	w.observe(t, err)
+}
+
+func (w *weightedBackend) setHealthy(index int) {
+	w.observe(w.targets[index], nil)
+}
+
+func (w *weightedBackend) SendMessage(message *GELFMessage) error {
+	tried := make(map[*weightedTarget]bool, len(w.targets))
+	var errs []error
+	now := time.Now()
+	for t := w.pick(tried, now); t != nil; t = w.pick(tried, now) {
+		err := t.backend.SendMessage(message)
+		w.observe(t, err)
+		if err == nil {
+			return nil
+		}
+		tried[t] = true
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		if len(w.targets) == 0 {
+			return errors.New("weighted backend has no targets")
+		}
+		return errors.New("weighted backend: every target is down")
+	}
+	return errors.Join(errs...)
+}
+
+func (w *weightedBackend) Close() error {
+	var errs []error
+	for _, t := range w.targets {
+		if err := t.backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (w *weightedBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return errors.New("weighted backend does not support consuming")
+}
@@ -0,0 +1,113 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubBackend counts sends and fails them while down
+type stubBackend struct {
+	mu    sync.Mutex
+	down  bool
+	sends int
+}
+
+func (s *stubBackend) SendMessage(*GELFMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sends++
+	if s.down {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func (s *stubBackend) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func (s *stubBackend) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sends
+}
+
+func (s *stubBackend) Close() error { return nil }
+
+func (s *stubBackend) LaunchConsume(func(*GELFMessage) error) error { return nil }
+
+func TestWeightedSkipsFailingTarget(t *testing.T) {
+	for _, weight := range []int{1, 10} {
+		dead, healthy := &stubBackend{down: true}, &stubBackend{}
+		w := NewWeightedBackendWithOptions(WeightedOptions{RetryInterval: time.Hour},
+			WeightedTarget{Backend: dead, Weight: weight},
+			WeightedTarget{Backend: healthy, Weight: 1})
+		for i := 0; i < 1000; i++ {
+			if err := w.SendMessage(&GELFMessage{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := dead.count(); n != 1 {
+			t.Errorf("weight %d: the dead target got %d sends, want only the first", weight, n)
+		}
+		if n := healthy.count(); n != 1000 {
+			t.Errorf("weight %d: the healthy target got %d sends, want 1000", weight, n)
+		}
+	}
+}
+
+func TestWeightedProbe(t *testing.T) {
+	a, b := &stubBackend{down: true}, &stubBackend{}
+	var changes []bool
+	w := NewWeightedBackendWithOptions(WeightedOptions{
+		RetryInterval:  20 * time.Millisecond,
+		OnHealthChange: func(index int, healthy bool) { changes = append(changes, healthy) },
+	}, WeightedTarget{Backend: a}, WeightedTarget{Backend: b})
+
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			if err := w.SendMessage(&GELFMessage{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	send(10)
+	if n := a.count(); n != 1 {
+		t.Fatalf("down target got %d sends", n)
+	}
+
+	// a failed probe keeps it down for another interval
+	time.Sleep(30 * time.Millisecond)
+	send(10)
+	if n := a.count(); n != 2 {
+		t.Fatalf("down target got %d sends after its first probe, want 2", n)
+	}
+
+	a.setDown(false)
+	time.Sleep(30 * time.Millisecond)
+	send(10)
+	if n := a.count(); n < 5 {
+		t.Fatalf("recovered target got %d sends, want it back in rotation", n)
+	}
+	if len(changes) != 2 || changes[0] || !changes[1] {
+		t.Fatalf("health changes %v, want [false true]", changes)
+	}
+}
+
+func TestWeightedLastResort(t *testing.T) {
+	a, b := &stubBackend{down: true}, &stubBackend{down: true}
+	w := NewWeightedBackendWithOptions(WeightedOptions{RetryInterval: time.Hour},
+		WeightedTarget{Backend: a}, WeightedTarget{Backend: b})
+	if err := w.SendMessage(&GELFMessage{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	b.setDown(false)
+	// both are down, they are still tried before failing
+	if err := w.SendMessage(&GELFMessage{}); err != nil {
+		t.Fatal(err)
+	}
+}
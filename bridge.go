@@ -0,0 +1,208 @@
+package graylog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// RetryPolicy decides what the Bridge does with a message the destination rejected
+type RetryPolicy int
+
+const (
+	// RetryInPlace retries the destination MaxRetries times, then returns the
+	// error to the source, which may redeliver it (e.g. asynq retries)
+	RetryInPlace RetryPolicy = iota
+	// RetryRequeue sends the message back to the source queue
+	RetryRequeue
+	// RetrySpool appends the message to a local spool file, replayed to the
+	// destination every RetryInterval
+	RetrySpool
+)
+
+type BridgeOptions struct {
+	// Source backend consumed with LaunchConsume, e.g. the redis backend
+	Source Backend
+	// Destination backend messages are forwarded to, e.g. the gelf backend
+	Destination Backend
+	// Retry what to do when the destination fails, default RetryInPlace
+	Retry RetryPolicy
+	// MaxRetries attempts made by RetryInPlace, default 3
+	MaxRetries int
+	// RetryInterval pause between in place attempts and between spool replays, default 1s
+	RetryInterval time.Duration
+	// SpoolPath NDJSON file used by RetrySpool
+	SpoolPath string
+	// TransportLatency adds TransportLatencyKey to the messages stamped by a
+	// hook with StampEnqueuedAt: the milliseconds from the hook queueing the
+	// message to the bridge forwarding it, including the clock skew between
+	// the hosts. default false
+	TransportLatency bool
+}
+
+// Bridge forwards messages consumed from one backend to another, e.g. from a
+// redis queue to graylog
+type Bridge struct {
+	opts    BridgeOptions
+	spoolMu sync.Mutex
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewBridge(opts BridgeOptions) (*Bridge, error) {
+	if opts.Source == nil || opts.Destination == nil {
+		return nil, errors.New("bridge requires a source and a destination")
+	}
+	if opts.Retry == RetrySpool && opts.SpoolPath == "" {
+		return nil, errors.New("bridge spool path is required with RetrySpool")
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = time.Second
+	}
+	return &Bridge{opts: opts, done: make(chan struct{})}, nil
+}
+
+// Run consumes the source until it stops, blocking like LaunchConsume
+func (b *Bridge) Run() error {
+	if b.opts.Retry == RetrySpool {
+		b.wg.Add(1)
+		go b.replayLoop()
+	}
+	return b.opts.Source.LaunchConsume(b.forward)
+}
+
+func (b *Bridge) forward(message *GELFMessage) error {
+	if b.opts.TransportLatency {
+		message = withTransportLatency(message, time.Now())
+	}
+	err := b.opts.Destination.SendMessage(message)
+	if err == nil {
+		return nil
+	}
+
+	switch b.opts.Retry {
+	case RetryRequeue:
+		return b.opts.Source.SendMessage(message)
+	case RetrySpool:
+		return b.spool(message)
+	default:
+		for i := 1; i < b.opts.MaxRetries && err != nil; i++ {
+			time.Sleep(b.opts.RetryInterval)
+			err = b.opts.Destination.SendMessage(message)
+		}
+		return err
+	}
+}
+
+func (b *Bridge) spool(messages ...*GELFMessage) error {
+	var buf bytes.Buffer
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	b.spoolMu.Lock()
+	defer b.spoolMu.Unlock()
+	f, err := os.OpenFile(b.opts.SpoolPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+func (b *Bridge) replayLoop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.opts.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.replay(); err != nil {
+				internalLog.Printf("bridge spool replay error: %v", err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// replay 重新发送spool文件中的消息，发送失败的消息写回spool
+func (b *Bridge) replay() error {
+	replayPath := b.opts.SpoolPath + ".replay"
+	// a replay file left over by a failed replay is processed first
+	if _, err := os.Stat(replayPath); errors.Is(err, os.ErrNotExist) {
+		b.spoolMu.Lock()
+		err = os.Rename(b.opts.SpoolPath, replayPath)
+		b.spoolMu.Unlock()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(replayPath)
+	if err != nil {
+		return err
+	}
+	var failed []*GELFMessage
+	var sendErr error
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var message GELFMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			internalLog.Printf("bridge spool: dropping malformed line: %v", err)
+			continue
+		}
+		// once the destination fails, keep the rest for the next replay
+		if sendErr == nil {
+			sendErr = b.opts.Destination.SendMessage(&message)
+			if sendErr == nil {
+				continue
+			}
+		}
+		failed = append(failed, &message)
+	}
+	_ = f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		if err := b.spool(failed...); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(replayPath); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// Close stops spool replays and closes both backends, later calls return
+// the result of the first
+func (b *Bridge) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.wg.Wait()
+		b.closeErr = errors.Join(b.opts.Source.Close(), b.opts.Destination.Close())
+	})
+	return b.closeErr
+}
@@ -0,0 +1,19 @@
+package graylog
+
+import "testing"
+
+func TestBridgeCloseTwice(t *testing.T) {
+	source, destination := &closingBackend{}, &closingBackend{}
+	bridge, err := NewBridge(BridgeOptions{Source: source, Destination: destination})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := bridge.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source.closes() != 1 || destination.closes() != 1 {
+		t.Errorf("backends closed %d and %d times, want once", source.closes(), destination.closes())
+	}
+}
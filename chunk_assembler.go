@@ -0,0 +1,34 @@
+package graylog
+
+import (
+	"time"
+
+	"github.com/viruscoding/logrus-graylog-hook/gelf"
+)
+
+// ErrIncompleteChunk is returned for datagrams too short to carry a chunk header
+var ErrIncompleteChunk = gelf.ErrIncompleteChunk
+
+// ChunkAssembler reassembles chunked GELF messages from raw udp datagrams, the
+// inverse of the chunking done by the gelf backend, see gelf.Assembler
+type ChunkAssembler = gelf.Assembler
+
+// NewChunkAssembler creates an assembler dropping incomplete messages after
+// timeout, default 5s like graylog's own inputs
+func NewChunkAssembler(timeout time.Duration) *ChunkAssembler {
+	return gelf.NewAssembler(timeout)
+}
+
+// ChunkAssemblerOptions options of NewChunkAssemblerWithOptions, see gelf.AssemblerOptions
+type ChunkAssemblerOptions = gelf.AssemblerOptions
+
+// NewChunkAssemblerWithOptions creates an assembler bounding the incomplete
+// messages it holds
+func NewChunkAssemblerWithOptions(opts ChunkAssemblerOptions) *ChunkAssembler {
+	return gelf.NewAssemblerWithOptions(opts)
+}
+
+// IsChunked reports whether the datagram starts with the GELF chunk magic bytes
+func IsChunked(datagram []byte) bool {
+	return gelf.IsChunked(datagram)
+}
@@ -0,0 +1,93 @@
+package graylog
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	mrand "math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ChunkIDGenerator generates the 8 byte message id shared by all chunks of a
+// chunked GELF message. Implementations must be safe for concurrent use.
+type ChunkIDGenerator interface {
+	NextID(id *[8]byte) error
+}
+
+// randomIDGenerator reads ids from crypto/rand, buffering many ids per read
+type randomIDGenerator struct {
+	mu  sync.Mutex
+	buf []byte
+	off int
+}
+
+// NewRandomIDGenerator returns the default generator: crypto/rand buffered so
+// that one read serves many messages.
+func NewRandomIDGenerator() ChunkIDGenerator {
+	return &randomIDGenerator{buf: make([]byte, 8*512), off: 8 * 512}
+}
+
+func (g *randomIDGenerator) NextID(id *[8]byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.off+8 > len(g.buf) {
+		if _, err := io.ReadFull(rand.Reader, g.buf); err != nil {
+			return err
+		}
+		g.off = 0
+	}
+	copy(id[:], g.buf[g.off:g.off+8])
+	g.off += 8
+	return nil
+}
+
+// counterIDGenerator combines a hash of the hostname with a process local counter
+type counterIDGenerator struct {
+	prefix  uint32
+	counter uint32
+}
+
+// NewCounterIDGenerator returns a generator whose ids are a hash of the host
+// name followed by an incrementing counter. Cheapest option, ids are unique as
+// long as fewer than 2^32 chunked messages are in flight per host.
+func NewCounterIDGenerator() ChunkIDGenerator {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(host))
+	return &counterIDGenerator{
+		prefix:  h.Sum32(),
+		counter: uint32(time.Now().UnixNano()),
+	}
+}
+
+func (g *counterIDGenerator) NextID(id *[8]byte) error {
+	binary.BigEndian.PutUint32(id[:4], g.prefix)
+	binary.BigEndian.PutUint32(id[4:], atomic.AddUint32(&g.counter, 1))
+	return nil
+}
+
+// mathRandIDGenerator draws ids from a math/rand source
+type mathRandIDGenerator struct {
+	mu  sync.Mutex
+	rnd *mrand.Rand
+}
+
+// NewMathRandIDGenerator returns a generator backed by math/rand seeded with the
+// current time. Not cryptographically random, which message ids don't need.
+func NewMathRandIDGenerator() ChunkIDGenerator {
+	return &mathRandIDGenerator{rnd: mrand.New(mrand.NewSource(time.Now().UnixNano()))}
+}
+
+func (g *mathRandIDGenerator) NextID(id *[8]byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	binary.BigEndian.PutUint64(id[:], g.rnd.Uint64())
+	return nil
+}
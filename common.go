@@ -5,6 +5,8 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+
+	"github.com/viruscoding/logrus-graylog-hook/gelf"
 )
 
 const StackTraceKey = "_stacktrace"
@@ -79,83 +81,10 @@ func logrusLevelToSyslog(level logrus.Level) int32 {
 	}
 }
 
-// GELFMessage A GELF message is a JSON string with the following fields:
-// https://go2docs.graylog.org/5-0/getting_in_log_data/gelf.html#GELFPayloadSpecification
-type GELFMessage struct {
-	Version  string  `json:"version"`
-	Host     string  `json:"host"`
-	Short    string  `json:"short_message"`
-	Full     string  `json:"full_message"`
-	TimeUnix float64 `json:"timestamp"`
-	Level    int32   `json:"level"`
-	// Facility @Deprecated send as additional field instead
-	Facility string `json:"facility"`
-	// Line @Deprecated send as additional field instead
-	Line int `json:"line"`
-	// File @Deprecated send as additional field instead
-	File  string                 `json:"file"`
-	Extra map[string]interface{} `json:"-"`
-}
-
-type innerMessage GELFMessage // against circular (Un)MarshalJSON
-
-func (m *GELFMessage) MarshalJSON() ([]byte, error) {
-	var err error
-	var b, eb []byte
-
-	extra := m.Extra
-	b, err = json.Marshal((*innerMessage)(m))
-	m.Extra = extra
-	if err != nil {
-		return nil, err
-	}
-
-	if len(extra) == 0 {
-		return b, nil
-	}
-
-	if eb, err = json.Marshal(extra); err != nil {
-		return nil, err
-	}
-
-	// merge serialized message + serialized extra map
-	b[len(b)-1] = ','
-	return append(b, eb[1:]...), nil
-}
+// GELFMessage A GELF message, see gelf.Message
+type GELFMessage = gelf.Message
 
-func (m *GELFMessage) UnmarshalJSON(data []byte) error {
-	i := make(map[string]interface{}, 16)
-	if err := json.Unmarshal(data, &i); err != nil {
-		return err
-	}
-	for k, v := range i {
-		if k[0] == '_' {
-			if m.Extra == nil {
-				m.Extra = make(map[string]interface{}, 1)
-			}
-			m.Extra[k] = v
-			continue
-		}
-		switch k {
-		case "version":
-			m.Version = v.(string)
-		case "host":
-			m.Host = v.(string)
-		case "short_message":
-			m.Short = v.(string)
-		case "full_message":
-			m.Full = v.(string)
-		case "timestamp":
-			m.TimeUnix = v.(float64)
-		case "level":
-			m.Level = int32(v.(float64))
-		case "facility":
-			m.Facility = v.(string)
-		case "file":
-			m.File = v.(string)
-		case "line":
-			m.Line = int(v.(float64))
-		}
-	}
-	return nil
-}
+const (
+	GELFVersion10 = gelf.Version10
+	GELFVersion11 = gelf.Version11
+)
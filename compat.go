@@ -0,0 +1,184 @@
+package graylog
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errBackend fails every send with the error that prevented creating the real backend
+type errBackend struct {
+	err error
+}
+
+func (e *errBackend) SendMessage(*GELFMessage) error {
+	return e.err
+}
+
+func (e *errBackend) Close() error {
+	return nil
+}
+
+func (e *errBackend) LaunchConsume(func(message *GELFMessage) error) error {
+	return e.err
+}
+
+// newCompatBackend addr is host:port for udp like gemnasium/logrus-graylog-hook,
+// a scheme may be given to choose tcp
+func newCompatBackend(addr string) Backend {
+	if !strings.Contains(addr, "://") {
+		addr = "udp://" + addr
+	}
+	backend, err := NewGelfBackend(addr)
+	if err != nil {
+		internalLog.Printf("can't create gelf backend: %v\n", err)
+		return &errBackend{err: errors.New("gelf backend unavailable: " + err.Error())}
+	}
+	return backend
+}
+
+// GraylogHook is the hook type of gemnasium/logrus-graylog-hook, returned by
+// NewGraylogHook and NewAsyncGraylogHook so code declaring it keeps
+// compiling. It embeds the Hook doing the work: Flush, FlushAndClose etc. are
+// available. Writer and SetWriter, tied to the go-gelf writer, are not.
+type GraylogHook struct {
+	*Hook
+	// Extra additional fields of every message, the map given to the constructor
+	Extra map[string]interface{}
+	// Level most verbose level fired, read by logrus when the hook is added.
+	// default logrus.DebugLevel
+	Level logrus.Level
+	// blacklist entry fields not sent, see Blacklist
+	blacklist map[string]bool
+}
+
+func newGraylogHook(opts HookOptions) *GraylogHook {
+	return &GraylogHook{
+		Hook:  NewHook(opts),
+		Extra: opts.Extra,
+		Level: logrus.DebugLevel,
+	}
+}
+
+// NewGraylogHook creates a synchronous hook sending to the graylog udp input at
+// addr (host:port), compatible with gemnasium/logrus-graylog-hook.
+func NewGraylogHook(addr string, extra map[string]interface{}) *GraylogHook {
+	return newGraylogHook(HookOptions{
+		Backend:     newCompatBackend(addr),
+		Extra:       extra,
+		Synchronous: true,
+	})
+}
+
+// NewAsyncGraylogHook creates an asynchronous hook sending to the graylog udp
+// input at addr (host:port), compatible with gemnasium/logrus-graylog-hook.
+// Call Flush before exiting to send buffered messages.
+func NewAsyncGraylogHook(addr string, extra map[string]interface{}) *GraylogHook {
+	return newGraylogHook(HookOptions{
+		Backend: newCompatBackend(addr),
+		Extra:   extra,
+		// a single worker keeps messages in order, like the original
+		Concurrency: 1,
+	})
+}
+
+// Levels returns the levels up to Level
+func (g *GraylogHook) Levels() []logrus.Level {
+	var levels []logrus.Level
+	for _, level := range logrus.AllLevels {
+		if level <= g.Level {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// Blacklist sets the entry fields not sent, call it before logging
+func (g *GraylogHook) Blacklist(fields []string) {
+	g.blacklist = make(map[string]bool, len(fields))
+	for _, field := range fields {
+		g.blacklist[field] = true
+	}
+}
+
+func (g *GraylogHook) Fire(entry *logrus.Entry) error {
+	if len(g.blacklist) > 0 {
+		// copy, the entry is shared with the other hooks
+		e := *entry
+		e.Data = make(logrus.Fields, len(entry.Data))
+		for k, v := range entry.Data {
+			if !g.blacklist[k] {
+				e.Data[k] = v
+			}
+		}
+		entry = &e
+	}
+	return g.Hook.Fire(entry)
+}
+
+// CompatFieldsOptions configures CompatFieldsTransform
+type CompatFieldsOptions struct {
+	// Facility sent as _facility when the message has none, like the facility
+	// set by older hooks. default the message's deprecated facility field
+	Facility string
+	// KeepCallerFields keep sending _caller_file, _caller_line and
+	// _caller_function along with the renamed fields, so dashboards can be
+	// moved over gradually. default false
+	KeepCallerFields bool
+}
+
+// compatCallerFields caller fields of this package and their name in
+// gemnasium/logrus-graylog-hook and Graylog2/go-gelf
+var compatCallerFields = map[string]string{
+	"_caller_file":     "_file",
+	"_caller_line":     "_line",
+	"_caller_function": "_function",
+}
+
+// CompatFieldsTransform returns a transformation, see TransformBackend, sending
+// fields the way gemnasium/logrus-graylog-hook and Graylog2/go-gelf did, so
+// the graylog fields file, line, function and facility that existing
+// dashboards and stream rules use keep being filled after switching to this
+// package. The deprecated GELF file, line and facility fields are moved to
+// additional fields, which graylog stores under the same names.
+func CompatFieldsTransform(opts CompatFieldsOptions) TransformFunc {
+	return func(message *GELFMessage) (*GELFMessage, bool) {
+		// copy, the message may be shared with other backends
+		m := *message
+		m.Extra = make(map[string]interface{}, len(message.Extra)+4)
+		for k, v := range message.Extra {
+			m.Extra[k] = v
+		}
+
+		for from, to := range compatCallerFields {
+			v, ok := m.Extra[from]
+			if !ok {
+				continue
+			}
+			if _, set := m.Extra[to]; !set {
+				m.Extra[to] = v
+			}
+			if !opts.KeepCallerFields {
+				delete(m.Extra, from)
+			}
+		}
+		if _, set := m.Extra["_file"]; !set && m.File != "" {
+			m.Extra["_file"] = m.File
+		}
+		if _, set := m.Extra["_line"]; !set && m.Line != 0 {
+			m.Extra["_line"] = m.Line
+		}
+		m.File, m.Line = "", 0
+
+		facility := m.Facility
+		if facility == "" {
+			facility = opts.Facility
+		}
+		if _, set := m.Extra["_facility"]; !set && facility != "" {
+			m.Extra["_facility"] = facility
+		}
+		m.Facility = ""
+		return &m, true
+	}
+}
@@ -0,0 +1,38 @@
+package graylog
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestGraylogHookCompat(t *testing.T) {
+	var hook *GraylogHook = NewGraylogHook("127.0.0.1:12201", map[string]interface{}{"app": "x"})
+	recording := NewRecordingBackend()
+	if err := hook.SwapBackend(recording); err != nil {
+		t.Fatal(err)
+	}
+	hook.Level = logrus.InfoLevel
+	hook.Blacklist([]string{"password"})
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(hook)
+	logger.Debug("not fired")
+	logger.WithFields(logrus.Fields{"password": "secret", "user": "u"}).Info("login")
+	hook.Flush()
+
+	messages := recording.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d messages, want the info one only", len(messages))
+	}
+	m := messages[0]
+	if _, ok := m.Extra["_password"]; ok {
+		t.Error("blacklisted field sent")
+	}
+	if m.Extra["_user"] != "u" || m.Extra["_app"] != "x" {
+		t.Errorf("fields missing from %v", m.Extra)
+	}
+}
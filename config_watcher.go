@@ -0,0 +1,121 @@
+package graylog
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type ConfigWatcherOptions struct {
+	// Path JSON file holding a HookConfig, reloaded when it is modified
+	Path string
+	// Load source of the config instead of Path, e.g. a config service. Its
+	// result is applied when it differs from the previous one
+	Load func() (HookConfig, error)
+	// Interval between two checks, default 5s
+	Interval time.Duration
+	// NewBackend creates the backend when the address changes, see ApplyConfig
+	NewBackend func(addr string) (Backend, error)
+}
+
+// ConfigWatcher applies configuration changes to a hook at runtime
+type ConfigWatcher struct {
+	hook    *Hook
+	opts    ConfigWatcherOptions
+	last    *HookConfig
+	modTime time.Time
+	done    chan struct{}
+	wg      sync.WaitGroup
+	// closeOnce 重复Close不再关闭done
+	closeOnce sync.Once
+}
+
+// WatchConfig applies the current configuration to hook, failing when it
+// can't, then checks for changes every Interval until Close is called. Later
+// errors, e.g. an invalid file being edited, are printed and the previous
+// settings are kept.
+func WatchConfig(hook *Hook, opts ConfigWatcherOptions) (*ConfigWatcher, error) {
+	if (opts.Path == "") == (opts.Load == nil) {
+		return nil, errors.New("watch config: set exactly one of Path and Load")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	w := &ConfigWatcher{hook: hook, opts: opts, done: make(chan struct{})}
+	if err := w.check(); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w, nil
+}
+
+func (w *ConfigWatcher) loop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.check(); err != nil {
+				internalLog.Printf("reload hook config: %v", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// check 读取配置，有变化时应用
+func (w *ConfigWatcher) check() error {
+	var c HookConfig
+	if w.opts.Load != nil {
+		var err error
+		if c, err = w.opts.Load(); err != nil {
+			return err
+		}
+	} else {
+		info, err := os.Stat(w.opts.Path)
+		if err != nil {
+			return err
+		}
+		if w.last != nil && info.ModTime().Equal(w.modTime) {
+			return nil
+		}
+		data, err := os.ReadFile(w.opts.Path)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		w.modTime = info.ModTime()
+	}
+	if w.last != nil && reflect.DeepEqual(*w.last, c) {
+		return nil
+	}
+
+	apply := c
+	if w.last != nil && c.Addr == w.last.Addr {
+		// same address, keep the connected backend
+		apply.Addr = ""
+	}
+	if err := w.hook.ApplyConfig(apply, w.opts.NewBackend); err != nil {
+		return err
+	}
+	w.last = &c
+	return nil
+}
+
+// Close stops watching, the settings applied last stay in effect. Later calls
+// do nothing
+func (w *ConfigWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+	})
+	return nil
+}
@@ -0,0 +1,20 @@
+package graylog
+
+import "testing"
+
+func TestConfigWatcherCloseTwice(t *testing.T) {
+	hook := NewHook(HookOptions{Backend: NewRecordingBackend()})
+	defer hook.FlushAndClose()
+	w, err := WatchConfig(hook, ConfigWatcherOptions{
+		Load: func() (HookConfig, error) { return HookConfig{}, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
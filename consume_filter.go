@@ -0,0 +1,82 @@
+package graylog
+
+import (
+	"errors"
+	"strings"
+)
+
+// ConsumeFilter decides whether a consumed message is passed on
+type ConsumeFilter func(message *GELFMessage) bool
+
+// FilterConsumer wraps a LaunchConsume callback so that only messages accepted
+// by all filters reach f, the others are acknowledged and dropped. A queue
+// delivers each message to a single consumer, so consumers with different
+// filters must not compete on the same queue: a message one of them rejects
+// would never reach the others. Combine them with FanoutConsumer instead, or
+// give each its own queue, e.g. with RedisOptions.RoutingKey.
+func FilterConsumer(f func(message *GELFMessage) error, filters ...ConsumeFilter) func(message *GELFMessage) error {
+	return func(message *GELFMessage) error {
+		for _, filter := range filters {
+			if !filter(message) {
+				return nil
+			}
+		}
+		return f(message)
+	}
+}
+
+// FanoutConsumer combines LaunchConsume callbacks so that one queue feeds
+// several specialized consumers, each receiving every message and filtering
+// it on its own:
+//
+//	backend.LaunchConsume(graylog.FanoutConsumer(
+//		graylog.FilterConsumer(alert, graylog.MinLevel(graylog.LogWarning)),
+//		graylog.FilterConsumer(payments, graylog.FieldEquals("stream", "payments"))))
+//
+// The errors of the consumers are joined, the source then redelivers the
+// message to all of them, so consumers should tolerate duplicates.
+func FanoutConsumer(consumers ...func(message *GELFMessage) error) func(message *GELFMessage) error {
+	return func(message *GELFMessage) error {
+		var errs []error
+		for _, f := range consumers {
+			if err := f(message); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// MinLevel accepts messages at least as severe as the given syslog level, e.g.
+// MinLevel(LogWarning) accepts warnings, errors and above
+func MinLevel(level int32) ConsumeFilter {
+	return func(message *GELFMessage) bool {
+		return message.Level <= level
+	}
+}
+
+// extraField looks up an additional field given with or without its leading underscore
+func extraField(message *GELFMessage, field string) (interface{}, bool) {
+	v, ok := message.Extra["_"+strings.TrimPrefix(field, "_")]
+	return v, ok
+}
+
+// HasField accepts messages carrying the additional field
+func HasField(field string) ConsumeFilter {
+	return func(message *GELFMessage) bool {
+		_, ok := extraField(message, field)
+		return ok
+	}
+}
+
+// FieldEquals accepts messages whose additional field equals value. Numbers
+// decoded from the wire are compared by their textual form.
+func FieldEquals(field string, value interface{}) ConsumeFilter {
+	return func(message *GELFMessage) bool {
+		v, ok := extraField(message, field)
+		if !ok {
+			return false
+		}
+		return valuesEqual(v, value)
+	}
+}
@@ -0,0 +1,44 @@
+package graylog
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFanoutConsumer(t *testing.T) {
+	var warnings, payments []string
+	collect := func(into *[]string) func(*GELFMessage) error {
+		return func(m *GELFMessage) error {
+			*into = append(*into, m.Short)
+			return nil
+		}
+	}
+	consume := FanoutConsumer(
+		FilterConsumer(collect(&warnings), MinLevel(LogWarning)),
+		FilterConsumer(collect(&payments), FieldEquals("stream", "payments")),
+	)
+	messages := []*GELFMessage{
+		{Short: "error payment", Level: LogErr, Extra: map[string]interface{}{"_stream": "payments"}},
+		{Short: "info payment", Level: LogInfo, Extra: map[string]interface{}{"_stream": "payments"}},
+		{Short: "warning", Level: LogWarning},
+		{Short: "info", Level: LogInfo},
+	}
+	for _, m := range messages {
+		if err := consume(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warnings) != 2 || warnings[0] != "error payment" || warnings[1] != "warning" {
+		t.Errorf("warning consumer got %v", warnings)
+	}
+	// a message rejected by one consumer still reaches the other
+	if len(payments) != 2 || payments[1] != "info payment" {
+		t.Errorf("payments consumer got %v", payments)
+	}
+
+	failing := errors.New("down")
+	consume = FanoutConsumer(collect(&payments), func(*GELFMessage) error { return failing })
+	if err := consume(messages[0]); !errors.Is(err, failing) {
+		t.Errorf("fanout returned %v, want the failing consumer's error", err)
+	}
+}
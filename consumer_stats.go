@@ -0,0 +1,69 @@
+package graylog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConsumerStats counters of a consumer started with LaunchConsume or GelfServer.Serve
+type ConsumerStats struct {
+	// Processed messages handed to the consumer callback successfully
+	Processed uint64
+	// Failed messages that could not be decoded or whose callback returned an error
+	Failed uint64
+	// Retried deliveries of messages that had failed before
+	Retried uint64
+	// ProcessedPerSecond throughput since the previous call to ConsumerStats
+	ProcessedPerSecond float64
+	// QueueSize messages waiting to be consumed, when the transport knows it
+	QueueSize int
+	// QueueLag age of the oldest waiting message, when the transport knows it
+	QueueLag time.Duration
+}
+
+// ConsumerStatsProvider is implemented by consumers exposing ConsumerStats,
+// e.g. the redis backend and GelfServer
+type ConsumerStatsProvider interface {
+	ConsumerStats() (ConsumerStats, error)
+}
+
+// consumerMetrics counts consumed messages, shared by the consumer implementations
+type consumerMetrics struct {
+	processed atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+
+	mu            sync.Mutex
+	lastProcessed uint64
+	lastTime      time.Time
+}
+
+func (c *consumerMetrics) observe(err error) {
+	if err != nil {
+		c.failed.Add(1)
+	} else {
+		c.processed.Add(1)
+	}
+}
+
+func (c *consumerMetrics) stats() ConsumerStats {
+	processed := c.processed.Load()
+	stats := ConsumerStats{
+		Processed: processed,
+		Failed:    c.failed.Load(),
+		Retried:   c.retried.Load(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if !c.lastTime.IsZero() {
+		if elapsed := now.Sub(c.lastTime).Seconds(); elapsed > 0 {
+			stats.ProcessedPerSecond = float64(processed-c.lastProcessed) / elapsed
+		}
+	}
+	c.lastProcessed = processed
+	c.lastTime = now
+	return stats
+}
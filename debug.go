@@ -0,0 +1,91 @@
+package graylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HookSnapshot state of a hook for troubleshooting, see Hook.Snapshot
+type HookSnapshot struct {
+	Time        time.Time `json:"time"`
+	Synchronous bool      `json:"synchronous"`
+	// QueueDepth entries waiting in the queue, Pending includes those being sent
+	QueueDepth int   `json:"queue_depth"`
+	Pending    int64 `json:"pending"`
+	Workers    int64 `json:"workers"`
+	// OldestEntryAgeMs upper bound of the time the oldest queued entry has been
+	// waiting: the age of the last entry a worker took from the queue
+	OldestEntryAgeMs float64         `json:"oldest_entry_age_ms"`
+	Backends         []BackendState  `json:"backends"`
+	InternalErrors   []InternalError `json:"internal_errors"`
+	// Muted entries dropped by mute rules since the hook was created,
+	// MuteRules the active rules
+	Muted     uint64          `json:"muted"`
+	MuteRules []MuteRuleState `json:"mute_rules"`
+}
+
+// BackendState describes one backend of a hook
+type BackendState struct {
+	Type  string                 `json:"type"`
+	State map[string]interface{} `json:"state,omitempty"`
+}
+
+// backendStater is implemented by backends able to describe their state
+type backendStater interface {
+	debugState() map[string]interface{}
+}
+
+// Snapshot returns the current state of the hook, the queue and its backends,
+// along with the package's recent internal errors
+func (u *Hook) Snapshot() HookSnapshot {
+	now := time.Now()
+	s := HookSnapshot{
+		Time:           now,
+		Synchronous:    u.synchronous,
+		Pending:        u.pending.Load(),
+		Workers:        u.workers.Load(),
+		InternalErrors: internalLog.recentErrors(),
+		Muted:          u.mutes.muted.Load(),
+		MuteRules:      u.mutes.states(),
+	}
+	if u.queue != nil {
+		s.QueueDepth = u.queue.Len()
+	}
+	if s.QueueDepth > 0 {
+		since := u.created
+		if last := u.lastDequeued.Load(); last > 0 {
+			since = time.Unix(0, last)
+		}
+		s.OldestEntryAgeMs = float64(now.Sub(since)) / float64(time.Millisecond)
+	}
+
+	backends := []Backend{}
+	if backend := u.currentBackend(); backend != nil {
+		backends = append(backends, backend)
+	}
+	u.workerBackendsMu.Lock()
+	backends = append(backends, u.workerBackends...)
+	u.workerBackendsMu.Unlock()
+	for _, b := range backends {
+		state := BackendState{Type: fmt.Sprintf("%T", b)}
+		if stater, ok := b.(backendStater); ok {
+			state.State = stater.debugState()
+		}
+		s.Backends = append(s.Backends, state)
+	}
+	return s
+}
+
+// DebugHandler serves Snapshot as JSON, mount it on an existing mux, e.g.
+//
+//	mux.Handle("/debug/graylog", hook.DebugHandler())
+func (u *Hook) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(u.Snapshot())
+	})
+}
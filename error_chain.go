@@ -0,0 +1,52 @@
+package graylog
+
+import "fmt"
+
+// ErrorChainKey additional field listing, outermost first, the errors wrapped
+// by the logged error, see HookOptions.DisableErrorChain
+const ErrorChainKey = "_error_chain"
+
+// maxErrorChain bounds the links sent, against huge or cyclic error trees
+const maxErrorChain = 32
+
+// maxErrorVisits bounds the errors walked, collapsed links included: an error
+// unwrapping to itself adds no link
+const maxErrorVisits = 8 * maxErrorChain
+
+// ErrorLink one error of an error chain
+type ErrorLink struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// errorChain flattens the tree of errors wrapped by err, depth first: Unwrap()
+// error, Unwrap() []error as built by errors.Join, and Cause() of pkg/errors.
+// Wrappers repeating the message of the error they wrap, e.g. pkg/errors
+// WithStack, are collapsed into one link.
+func errorChain(err error) []ErrorLink {
+	var chain []ErrorLink
+	visits := 0
+	var walk func(err error, parent string)
+	walk = func(err error, parent string) {
+		if err == nil || len(chain) >= maxErrorChain || visits >= maxErrorVisits {
+			return
+		}
+		visits++
+		msg := err.Error()
+		if msg != parent || len(chain) == 0 {
+			chain = append(chain, ErrorLink{Type: fmt.Sprintf("%T", err), Message: msg})
+		}
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, child := range e.Unwrap() {
+				walk(child, msg)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap(), msg)
+		case causer:
+			walk(e.Cause(), msg)
+		}
+	}
+	walk(err, "")
+	return chain
+}
@@ -0,0 +1,64 @@
+package graylog
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+// selfError unwraps to itself
+type selfError struct{}
+
+func (e *selfError) Error() string { return "self" }
+func (e *selfError) Unwrap() error { return e }
+
+// cycleError unwraps to next, with the same message
+type cycleError struct{ next *cycleError }
+
+func (e *cycleError) Error() string { return "cycle" }
+func (e *cycleError) Unwrap() error { return e.next }
+
+func TestErrorChain(t *testing.T) {
+	base := errors.New("base")
+	cycle := &cycleError{}
+	cycle.next = &cycleError{next: cycle}
+
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{"single", base, []string{"base"}},
+		{"wrapped", fmt.Errorf("outer: %w", base), []string{"outer: base", "base"}},
+		{"joined", errors.Join(base, errors.New("other")), []string{"base\nother", "base", "other"}},
+		{"pkg/errors stack collapsed", pkgerrors.WithStack(base), []string{"base"}},
+		{"pkg/errors wrap", pkgerrors.Wrap(base, "ctx"), []string{"ctx: base", "base"}},
+		{"unwraps to itself", &selfError{}, []string{"self"}},
+		{"cycle of equal messages", cycle, []string{"cycle"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := errorChain(tt.err)
+			if len(chain) != len(tt.want) {
+				t.Fatalf("got %v, want %v", chain, tt.want)
+			}
+			for i, link := range chain {
+				if link.Message != tt.want[i] {
+					t.Fatalf("link %d = %q, want %q", i, link.Message, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestErrorChainBounded(t *testing.T) {
+	err := errors.New("root")
+	for i := 0; i < 100; i++ {
+		err = fmt.Errorf("wrap %d: %w", i, err)
+	}
+	if n := len(errorChain(err)); n != maxErrorChain {
+		t.Fatalf("got %d links, want %d", n, maxErrorChain)
+	}
+}
@@ -0,0 +1,95 @@
+package graylog
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+)
+
+// fieldNameRegexp valid GELF additional field names, without the leading underscore
+var fieldNameRegexp = regexp.MustCompile(`^[\w.\-]+$`)
+
+// ValidateFieldName checks that name, given without the leading underscore the
+// hook adds, is a valid GELF additional field name
+func ValidateFieldName(name string) error {
+	if !fieldNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid field name %q: must match %s", name, fieldNameRegexp)
+	}
+	if name == "id" {
+		return fmt.Errorf("invalid field name %q: _id is reserved", name)
+	}
+	return nil
+}
+
+// ExtraFields builds the Extra map of HookOptions, validating names and values
+// as they are added. The first error is kept and returned by Map.
+//
+//	extra, err := graylog.NewExtraFields().
+//		AddString("app", "payments").
+//		AddInt("shard", 3).
+//		Map()
+type ExtraFields struct {
+	fields map[string]interface{}
+	err    error
+}
+
+func NewExtraFields() *ExtraFields {
+	return &ExtraFields{fields: make(map[string]interface{})}
+}
+
+func (f *ExtraFields) add(name string, value interface{}) *ExtraFields {
+	if f.err != nil {
+		return f
+	}
+	if err := ValidateFieldName(name); err != nil {
+		f.err = err
+		return f
+	}
+	if _, ok := f.fields[name]; ok {
+		f.err = fmt.Errorf("duplicate field %q", name)
+		return f
+	}
+	f.fields[name] = value
+	return f
+}
+
+func (f *ExtraFields) AddString(name, value string) *ExtraFields {
+	return f.add(name, value)
+}
+
+func (f *ExtraFields) AddInt(name string, value int64) *ExtraFields {
+	return f.add(name, value)
+}
+
+// AddFloat adds a numeric field, NaN and infinities are rejected since they
+// can't be encoded as JSON
+func (f *ExtraFields) AddFloat(name string, value float64) *ExtraFields {
+	if f.err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		f.err = fmt.Errorf("invalid value for field %q: %v", name, value)
+		return f
+	}
+	return f.add(name, value)
+}
+
+// AddTime adds a time as an RFC3339 string
+func (f *ExtraFields) AddTime(name string, value time.Time) *ExtraFields {
+	return f.add(name, value.Format(time.RFC3339Nano))
+}
+
+// Err returns the first error encountered while adding fields
+func (f *ExtraFields) Err() error {
+	return f.err
+}
+
+// Map returns the fields in the format expected by HookOptions.Extra
+func (f *ExtraFields) Map() (map[string]interface{}, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	m := make(map[string]interface{}, len(f.fields))
+	for k, v := range f.fields {
+		m[k] = v
+	}
+	return m, nil
+}
@@ -0,0 +1,122 @@
+package graylog
+
+import (
+	"encoding/json"
+	"sort"
+	"unicode/utf8"
+)
+
+// ExtraOverflowKey additional field holding, as a JSON object string, the
+// fields folded by HookOptions.MaxFields and MaxMessageSize
+const ExtraOverflowKey = "_extra_overflow"
+
+const truncatedSuffix = "...(truncated)"
+
+// jsonSize length of the JSON encoding of v
+func jsonSize(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// fieldSize approximate bytes a field takes in the message: "key":value,
+func fieldSize(k string, v interface{}) int {
+	return jsonSize(k) + jsonSize(v) + 2
+}
+
+// enforceFieldBudget folds the additional fields exceeding HookOptions.MaxFields
+// and MaxMessageSize into ExtraOverflowKey. Fields set by the package itself
+// are never folded.
+func (u *Hook) enforceFieldBudget(m *GELFMessage, notes *pipelineNotes) {
+	maxFields, maxSize := u.opts.MaxFields, u.opts.MaxMessageSize
+	if maxFields <= 0 && maxSize <= 0 {
+		return
+	}
+
+	var names []string
+	for k := range m.Extra {
+		if !unprefixedFields[k] {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	overflow := map[string]interface{}{}
+	fold := func(k string) {
+		overflow[k[1:]] = m.Extra[k]
+		delete(m.Extra, k)
+	}
+
+	// 字段数超限：保留按名称排序靠前的字段，溢出字段本身占一个名额
+	if maxFields > 0 && len(m.Extra) > maxFields {
+		n := len(m.Extra) - maxFields + 1
+		if n > len(names) {
+			n = len(names)
+		}
+		for _, k := range names[len(names)-n:] {
+			fold(k)
+		}
+		names = names[:len(names)-n]
+	}
+
+	// 大小超限：从最大的字段开始折叠
+	size := 0
+	if maxSize > 0 {
+		size = jsonSize(m)
+		if size > maxSize {
+			sizes := make(map[string]int, len(names))
+			for _, k := range names {
+				sizes[k] = fieldSize(k, m.Extra[k])
+			}
+			sort.SliceStable(names, func(i, j int) bool { return sizes[names[i]] > sizes[names[j]] })
+			for _, k := range names {
+				if size <= maxSize {
+					break
+				}
+				size -= sizes[k]
+				fold(k)
+			}
+		}
+	}
+
+	if len(overflow) == 0 {
+		return
+	}
+	data, err := json.Marshal(overflow)
+	if err != nil {
+		return
+	}
+	value := string(data)
+	notes.add("folded %d fields into %s", len(overflow), ExtraOverflowKey[1:])
+	if maxSize > 0 {
+		truncated := truncateJSONString(value, maxSize-size-fieldSize(ExtraOverflowKey, ""))
+		if truncated != value {
+			notes.add("truncated %s", ExtraOverflowKey[1:])
+		}
+		value = truncated
+	}
+	m.Extra[ExtraOverflowKey] = value
+}
+
+// truncateJSONString shortens s so that its JSON encoding, quotes excluded,
+// fits in budget bytes
+func truncateJSONString(s string, budget int) string {
+	excess := jsonSize(s) - 2 - budget
+	if excess <= 0 {
+		return s
+	}
+	cut := len(s) - excess - len(truncatedSuffix)
+	for cut > 0 {
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		t := s[:cut] + truncatedSuffix
+		if jsonSize(t)-2 <= budget {
+			return t
+		}
+		cut -= jsonSize(t) - 2 - budget
+	}
+	return truncatedSuffix
+}
@@ -0,0 +1,38 @@
+package graylog
+
+import (
+	"strings"
+	"time"
+)
+
+// normalizeFields sends time.Duration values as a numeric _<name>_ms and
+// time.Time values formatted with HookOptions.TimeFormat, instead of the
+// nanosecond integer and layout encoding/json would produce
+func (u *Hook) normalizeFields(extra map[string]interface{}, notes *pipelineNotes) {
+	if u.opts.DisableTimeNormalization {
+		return
+	}
+	var durations []string
+	for k, v := range extra {
+		switch t := v.(type) {
+		case time.Duration:
+			durations = append(durations, k)
+		case time.Time:
+			extra[k] = t.Format(u.opts.TimeFormat)
+		case *time.Time:
+			if t != nil {
+				extra[k] = t.Format(u.opts.TimeFormat)
+			}
+		}
+	}
+	for _, k := range durations {
+		d := extra[k].(time.Duration)
+		delete(extra, k)
+		name := k
+		if !strings.HasSuffix(k, "_ms") {
+			k += "_ms"
+		}
+		extra[k] = float64(d) / float64(time.Millisecond)
+		notes.add("converted duration %s to %s", name[1:], k[1:])
+	}
+}
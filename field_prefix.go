@@ -0,0 +1,56 @@
+package graylog
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// unprefixedFields fields set by the package itself, or read by backends and
+// graylog stream rules, which keep their name when HookOptions.FieldPrefix is set
+var unprefixedFields = map[string]bool{
+	"_caller_file":     true,
+	"_caller_line":     true,
+	"_caller_function": true,
+	StackTraceKey:      true,
+	ErrorChainKey:      true,
+	ClockOffsetKey:     true,
+	EnqueuedAtKey:      true,
+	StreamKey:          true,
+	NoCompressKey:      true,
+	MessageIDKey:       true,
+	PipelineNotesKey:   true,
+}
+
+// fieldPrefix 前缀不以分隔符结尾时加上"."，已带前缀的字段按前缀加分隔符判断
+func fieldPrefix(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	if r, _ := utf8.DecodeLastRuneInString(prefix); unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return prefix + "."
+	}
+	return prefix
+}
+
+// prefixFields applies HookOptions.FieldPrefix to the additional fields
+func (u *Hook) prefixFields(extra map[string]interface{}, notes *pipelineNotes) {
+	prefix := u.opts.FieldPrefix
+	if prefix == "" {
+		return
+	}
+	var keys []string
+	for k := range extra {
+		// fields already in the namespace are left alone
+		if !unprefixedFields[k] && !strings.HasPrefix(k, "_"+prefix) {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		extra["_"+prefix+k[1:]] = extra[k]
+		delete(extra, k)
+	}
+	if len(keys) > 0 {
+		notes.add("prefixed %d fields with %s", len(keys), prefix)
+	}
+}
@@ -0,0 +1,34 @@
+package graylog
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFieldPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		fields logrus.Fields
+		want   []string
+	}{
+		// a field merely starting with the prefix text is still prefixed
+		{"pay", logrus.Fields{"payload": 1, "pay.x": 2}, []string{"_pay.payload", "_pay.x"}},
+		{"payments.", logrus.Fields{"payments.status": 1, "paymentsx": 2}, []string{"_payments.status", "_payments.paymentsx"}},
+		{"payments_", logrus.Fields{"payments_id": 1, "id2": 2}, []string{"_payments_id", "_payments_id2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			logger, recording := recordingLogger()
+			logger.ReplaceHooks(logrus.LevelHooks{})
+			logger.AddHook(NewHook(HookOptions{Backend: recording, Synchronous: true, FieldPrefix: tt.prefix}))
+			logger.WithFields(tt.fields).Info("m")
+			m := recording.LastMessage()
+			for _, k := range tt.want {
+				if _, ok := m.Extra[k]; !ok {
+					t.Errorf("%s missing from %v", k, m.Extra)
+				}
+			}
+		})
+	}
+}
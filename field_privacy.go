@@ -0,0 +1,69 @@
+package graylog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// hashValue sha256 of the salted textual value, hex encoded
+func hashValue(salt string, v interface{}) string {
+	sum := sha256.Sum256([]byte(salt + fmt.Sprint(v)))
+	return hex.EncodeToString(sum[:])
+}
+
+// bucketValue labels a number with the range of sorted bounds it falls in:
+// "<b0", "b0-b1", ..., ">=bn". ok is false when v is not a number.
+func bucketValue(bounds []float64, v interface{}) (string, bool) {
+	c, ok := coerceValue(v, FieldTypeNumber)
+	if !ok {
+		return "", false
+	}
+	f, err := strconv.ParseFloat(fmt.Sprint(c), 64)
+	if err != nil {
+		return "", false
+	}
+	i := sort.SearchFloat64s(bounds, f)
+	if i < len(bounds) && bounds[i] == f {
+		i += 1
+	}
+	format := func(b float64) string {
+		return strconv.FormatFloat(b, 'f', -1, 64)
+	}
+	switch {
+	case i == 0:
+		return "<" + format(bounds[0]), true
+	case i == len(bounds):
+		return ">=" + format(bounds[len(bounds)-1]), true
+	default:
+		return format(bounds[i-1]) + "-" + format(bounds[i]), true
+	}
+}
+
+// protectFields applies HookOptions.HashedFields and BucketedFields
+func (u *Hook) protectFields(extra map[string]interface{}, notes *pipelineNotes) {
+	for _, name := range u.opts.HashedFields {
+		k := "_" + name
+		if v, ok := extra[k]; ok {
+			extra[k] = hashValue(u.opts.HashSalt, v)
+			notes.add("hashed %s", name)
+		}
+	}
+	for name, bounds := range u.opts.BucketedFields {
+		k := "_" + name
+		v, ok := extra[k]
+		if !ok || len(bounds) == 0 {
+			continue
+		}
+		if label, ok := bucketValue(bounds, v); ok {
+			extra[k] = label
+			notes.add("bucketed %s", name)
+		} else {
+			// not a number, don't leak the raw value
+			delete(extra, k)
+			notes.add("dropped %s: not a number", name)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package graylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldTypeString:
+		return "string"
+	case FieldTypeNumber:
+		return "number"
+	}
+	return fmt.Sprintf("FieldType(%d)", int(t))
+}
+
+// SchemaAction what the hook does with a field not matching its FieldSchema
+type SchemaAction int
+
+const (
+	// SchemaCoerce converts the value to the registered type, like
+	// HookOptions.FieldTypes, or moves it to _<name>_raw when it can't. default
+	SchemaCoerce SchemaAction = iota
+	// SchemaWarn sends the field unchanged, only reporting the violation
+	SchemaWarn
+	// SchemaDropField removes the field from the message
+	SchemaDropField
+	// SchemaDropMessage doesn't send the message. Panic and fatal entries are
+	// still sent, with the field removed
+	SchemaDropMessage
+)
+
+// FieldSchema registry of the expected type of additional fields, by name as
+// logged, e.g. shared by the hooks of a process to keep the elasticsearch
+// mappings behind graylog stable. A duration field d is registered as d_ms,
+// see HookOptions.DisableTimeNormalization. Safe for concurrent use.
+type FieldSchema struct {
+	mu    sync.RWMutex
+	types map[string]FieldType
+}
+
+// NewFieldSchema returns a schema with the fields of types registered
+func NewFieldSchema(types map[string]FieldType) *FieldSchema {
+	s := &FieldSchema{types: make(map[string]FieldType, len(types))}
+	for name, t := range types {
+		s.types[name] = t
+	}
+	return s
+}
+
+// Register sets the expected type of a field, replacing the previous one
+func (s *FieldSchema) Register(name string, t FieldType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types[name] = t
+}
+
+// Lookup returns the expected type of a field
+func (s *FieldSchema) Lookup(name string) (FieldType, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.types[name]
+	return t, ok
+}
+
+// SchemaViolation a field whose value doesn't match the type registered in
+// HookOptions.Schema
+type SchemaViolation struct {
+	// Field name as logged
+	Field    string
+	Expected FieldType
+	Value    interface{}
+}
+
+func (v SchemaViolation) Error() string {
+	return fmt.Sprintf("field %s: expected %s, got %T", v.Field, v.Expected, v.Value)
+}
+
+// matchesFieldType reports whether v is sent as a JSON value of type t
+func matchesFieldType(v interface{}, t FieldType) bool {
+	switch t {
+	case FieldTypeString:
+		_, ok := v.(string)
+		return ok
+	case FieldTypeNumber:
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, json.Number:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// enforceSchema applies HookOptions.Schema and returns the violations found.
+// With SchemaDropMessage the fields are left as they are unless urgent, the
+// caller drops the message
+func (u *Hook) enforceSchema(extra map[string]interface{}, urgent bool, notes *pipelineNotes) []SchemaViolation {
+	schema := u.opts.Schema
+	if schema == nil {
+		return nil
+	}
+	var violations []SchemaViolation
+	schema.mu.RLock()
+	for k, v := range extra {
+		if unprefixedFields[k] {
+			continue
+		}
+		name := k[1:]
+		t, ok := schema.types[name]
+		if !ok || matchesFieldType(v, t) {
+			continue
+		}
+		violations = append(violations, SchemaViolation{Field: name, Expected: t, Value: v})
+	}
+	schema.mu.RUnlock()
+
+	for _, violation := range violations {
+		k := "_" + violation.Field
+		switch u.opts.SchemaAction {
+		case SchemaCoerce:
+			if c, ok := coerceValue(violation.Value, violation.Expected); ok {
+				extra[k] = c
+				notes.add("coerced %s to schema", violation.Field)
+			} else {
+				delete(extra, k)
+				extra[k+"_raw"] = fmt.Sprint(violation.Value)
+				notes.add("moved %s to %s_raw: not coercible to schema", violation.Field, violation.Field)
+			}
+		case SchemaDropField:
+			delete(extra, k)
+			notes.add("dropped %s: expected %s", violation.Field, violation.Expected)
+		case SchemaDropMessage:
+			if urgent {
+				delete(extra, k)
+				notes.add("dropped %s: expected %s", violation.Field, violation.Expected)
+			}
+		}
+		if u.opts.OnSchemaViolation != nil {
+			u.opts.OnSchemaViolation(violation)
+		} else if u.opts.SchemaAction == SchemaWarn {
+			internalLog.Printf("graylog schema: %v", violation)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,83 @@
+package graylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// FieldType type an additional field is coerced to before sending
+type FieldType int
+
+const (
+	// FieldTypeString sends the value formatted as a string
+	FieldTypeString FieldType = iota + 1
+	// FieldTypeNumber sends the value as a number, strings are parsed
+	FieldTypeNumber
+)
+
+// coerceValue converts v to t, ok is false when v can't be represented as t
+func coerceValue(v interface{}, t FieldType) (interface{}, bool) {
+	switch t {
+	case FieldTypeString:
+		switch s := v.(type) {
+		case string:
+			return s, true
+		case fmt.Stringer:
+			return s.String(), true
+		case error:
+			return s.Error(), true
+		default:
+			return fmt.Sprint(v), true
+		}
+	case FieldTypeNumber:
+		switch n := v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return n, true
+		case json.Number:
+			return n, true
+		case time.Duration:
+			return int64(n), true
+		case bool:
+			if n {
+				return 1, true
+			}
+			return 0, true
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return i, true
+			}
+			// NaN和Inf不是合法的JSON数字
+			if f, err := strconv.ParseFloat(n, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+				return f, true
+			}
+		}
+		return nil, false
+	}
+	return v, true
+}
+
+// coerceFields applies HookOptions.FieldTypes. Values that can't be coerced are
+// moved to _<name>_raw as strings, so the typed field keeps a single type in graylog.
+func (u *Hook) coerceFields(extra map[string]interface{}, notes *pipelineNotes) {
+	for name, t := range u.opts.FieldTypes {
+		k := "_" + name
+		v, ok := extra[k]
+		if !ok {
+			continue
+		}
+		if c, ok := coerceValue(v, t); ok {
+			if reflect.TypeOf(c) != reflect.TypeOf(v) {
+				notes.add("coerced %s", name)
+			}
+			extra[k] = c
+		} else {
+			delete(extra, k)
+			extra[k+"_raw"] = fmt.Sprint(v)
+			notes.add("moved %s to %s_raw: not coercible", name, name)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package graylog
+
+import "testing"
+
+func TestCoerceValueNonFinite(t *testing.T) {
+	for _, s := range []string{"NaN", "Inf", "-Inf", "+infinity"} {
+		if v, ok := coerceValue(s, FieldTypeNumber); ok {
+			t.Errorf("%q coerced to %v, want it kept raw", s, v)
+		}
+	}
+	if v, ok := coerceValue("1.5", FieldTypeNumber); !ok || v != 1.5 {
+		t.Errorf("1.5 coerced to %v, %v", v, ok)
+	}
+}
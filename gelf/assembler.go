@@ -0,0 +1,179 @@
+package gelf
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrIncompleteChunk is returned for datagrams too short to carry a chunk header
+var ErrIncompleteChunk = errors.New("gelf: datagram shorter than chunk header")
+
+type chunkSet struct {
+	id       [8]byte
+	chunks   [][]byte
+	received int
+	size     int
+	first    time.Time
+	// elem position in Assembler.order
+	elem *list.Element
+}
+
+// AssemblerOptions options of NewAssemblerWithOptions
+type AssemblerOptions struct {
+	// Timeout after which incomplete messages are dropped, default 5s like
+	// graylog's own inputs
+	Timeout time.Duration
+	// MaxPending incomplete messages held, the oldest is dropped to make
+	// room for a new one. default 10000
+	MaxPending int
+	// MaxPendingBytes bytes of chunks held, the oldest incomplete messages
+	// are dropped to stay under it. default 64MB
+	MaxPendingBytes int
+}
+
+// Assembler reassembles chunked GELF messages from raw udp datagrams, the
+// inverse of Chunks. Incomplete sets are evicted once they are older than the
+// timeout, or oldest first when the limits of AssemblerOptions are reached,
+// so a flood of partial messages can't exhaust the memory. It is safe for
+// concurrent use.
+type Assembler struct {
+	mu      sync.Mutex
+	opts    AssemblerOptions
+	pending map[[8]byte]*chunkSet
+	// order incomplete sets, oldest first
+	order     *list.List
+	bytes     int
+	lastEvict time.Time
+}
+
+// NewAssembler creates an assembler dropping incomplete messages after
+// timeout, default 5s like graylog's own inputs
+func NewAssembler(timeout time.Duration) *Assembler {
+	return NewAssemblerWithOptions(AssemblerOptions{Timeout: timeout})
+}
+
+func NewAssemblerWithOptions(opts AssemblerOptions) *Assembler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 10000
+	}
+	if opts.MaxPendingBytes <= 0 {
+		opts.MaxPendingBytes = 64 << 20
+	}
+	return &Assembler{
+		opts:      opts,
+		pending:   make(map[[8]byte]*chunkSet),
+		order:     list.New(),
+		lastEvict: time.Now(),
+	}
+}
+
+// Add accepts one datagram. It returns the complete payload when the datagram
+// was not chunked or completed a message, and nil while chunks are missing.
+// The returned payload is still compressed as sent.
+func (a *Assembler) Add(datagram []byte) ([]byte, error) {
+	if !IsChunked(datagram) {
+		return datagram, nil
+	}
+	if len(datagram) < ChunkHeaderLen {
+		return nil, ErrIncompleteChunk
+	}
+
+	var id [8]byte
+	copy(id[:], datagram[2:10])
+	seq, count := int(datagram[10]), int(datagram[11])
+	if count == 0 || count > MaxChunks || seq >= count {
+		return nil, fmt.Errorf("gelf: invalid chunk %d/%d", seq, count)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(a.lastEvict) >= a.opts.Timeout {
+		a.evict(now)
+	}
+
+	set, ok := a.pending[id]
+	if !ok {
+		for len(a.pending) >= a.opts.MaxPending {
+			a.remove(a.order.Front().Value.(*chunkSet))
+		}
+		set = &chunkSet{id: id, chunks: make([][]byte, count), first: now}
+		set.elem = a.order.PushBack(set)
+		a.pending[id] = set
+	}
+	if len(set.chunks) != count {
+		a.remove(set)
+		return nil, fmt.Errorf("gelf: chunk count changed from %d to %d", len(set.chunks), count)
+	}
+	if set.chunks[seq] != nil {
+		// duplicate datagram
+		return nil, nil
+	}
+	// copy, callers usually reuse their read buffer
+	chunk := make([]byte, len(datagram)-ChunkHeaderLen)
+	copy(chunk, datagram[ChunkHeaderLen:])
+	set.chunks[seq] = chunk
+	set.received += 1
+	set.size += len(chunk)
+	a.bytes += len(chunk)
+	if set.received < count {
+		for a.bytes > a.opts.MaxPendingBytes {
+			oldest := a.order.Front().Value.(*chunkSet)
+			a.remove(oldest)
+			if oldest == set {
+				return nil, fmt.Errorf("gelf: message exceeds MaxPendingBytes of %d", a.opts.MaxPendingBytes)
+			}
+		}
+		return nil, nil
+	}
+
+	a.remove(set)
+	payload := make([]byte, 0, set.size)
+	for _, c := range set.chunks {
+		payload = append(payload, c...)
+	}
+	return payload, nil
+}
+
+// Evict drops incomplete messages older than the timeout and returns how many
+// were dropped. Add calls it regularly, an explicit call is only needed when
+// datagrams stop arriving.
+func (a *Assembler) Evict() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.evict(time.Now())
+}
+
+func (a *Assembler) evict(now time.Time) int {
+	a.lastEvict = now
+	var n int
+	for e := a.order.Front(); e != nil; e = a.order.Front() {
+		set := e.Value.(*chunkSet)
+		if now.Sub(set.first) < a.opts.Timeout {
+			break
+		}
+		a.remove(set)
+		n += 1
+	}
+	return n
+}
+
+func (a *Assembler) remove(set *chunkSet) {
+	delete(a.pending, set.id)
+	a.order.Remove(set.elem)
+	a.bytes -= set.size
+}
+
+// Pending returns the number of incomplete messages being held
+func (a *Assembler) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
@@ -0,0 +1,238 @@
+package gelf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func mustChunks(t *testing.T, p []byte, id byte) [][]byte {
+	t.Helper()
+	chunks, err := Chunks(p, MinChunkSize, [8]byte{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chunks
+}
+
+func TestAssemblerOrder(t *testing.T) {
+	p := payload(5000)
+	tests := []struct {
+		name  string
+		order func(chunks [][]byte) [][]byte
+	}{
+		{"in order", func(c [][]byte) [][]byte { return c }},
+		{"reversed", func(c [][]byte) [][]byte {
+			r := make([][]byte, 0, len(c))
+			for i := len(c) - 1; i >= 0; i-- {
+				r = append(r, c[i])
+			}
+			return r
+		}},
+		{"shuffled", func(c [][]byte) [][]byte {
+			r := append([][]byte(nil), c...)
+			rand.New(rand.NewSource(1)).Shuffle(len(r), func(i, j int) { r[i], r[j] = r[j], r[i] })
+			return r
+		}},
+		{"duplicates", func(c [][]byte) [][]byte {
+			var r [][]byte
+			for _, chunk := range c[:len(c)-1] {
+				r = append(r, chunk, chunk)
+			}
+			return append(r, c[len(c)-1])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAssembler(time.Minute)
+			datagrams := tt.order(mustChunks(t, p, 1))
+			for i, d := range datagrams {
+				got, err := a.Add(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i < len(datagrams)-1 {
+					if got != nil {
+						t.Fatalf("payload returned after datagram %d of %d", i, len(datagrams))
+					}
+					continue
+				}
+				if !bytes.Equal(got, p) {
+					t.Fatal("reassembled payload differs")
+				}
+			}
+		})
+	}
+}
+
+func TestAssemblerInterleaved(t *testing.T) {
+	a := NewAssembler(time.Minute)
+	p1, p2 := payload(3000), payload(4000)
+	c1, c2 := mustChunks(t, p1, 1), mustChunks(t, p2, 2)
+	var got [][]byte
+	for i := 0; i < len(c1) || i < len(c2); i++ {
+		for _, c := range [][][]byte{c1, c2} {
+			if i >= len(c) {
+				continue
+			}
+			out, err := a.Add(c[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != nil {
+				got = append(got, out)
+			}
+		}
+	}
+	if len(got) != 2 || !bytes.Equal(got[0], p1) || !bytes.Equal(got[1], p2) {
+		t.Fatalf("got %d payloads, want both sets reassembled", len(got))
+	}
+}
+
+func TestAssemblerCopiesDatagrams(t *testing.T) {
+	a := NewAssembler(time.Minute)
+	p := payload(2000)
+	chunks := mustChunks(t, p, 1)
+	buf := make([]byte, MinChunkSize)
+	var got []byte
+	for _, c := range chunks {
+		// the read buffer is reused for every datagram
+		n := copy(buf, c)
+		out, err := a.Add(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range buf {
+			buf[i] = 0
+		}
+		if out != nil {
+			got = out
+		}
+	}
+	if !bytes.Equal(got, p) {
+		t.Fatal("reassembled payload differs")
+	}
+}
+
+func TestAssemblerUnchunked(t *testing.T) {
+	a := NewAssembler(0)
+	p := []byte(`{"short_message":"x"}`)
+	got, err := a.Add(p)
+	if err != nil || !bytes.Equal(got, p) {
+		t.Fatalf("Add = %q, %v", got, err)
+	}
+}
+
+func TestAssemblerInvalid(t *testing.T) {
+	header := func(seq, count byte) []byte {
+		return append([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, seq, count}, "data"...)
+	}
+	tests := []struct {
+		name     string
+		datagram []byte
+	}{
+		{"short header", []byte{0x1e, 0x0f, 1, 2, 3}},
+		{"zero count", header(0, 0)},
+		{"sequence past count", header(2, 2)},
+		{"too many chunks", header(0, MaxChunks+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAssembler(0)
+			if _, err := a.Add(tt.datagram); err == nil {
+				t.Fatal("expected an error")
+			}
+			if a.Pending() != 0 {
+				t.Fatal("invalid datagram left a pending set")
+			}
+		})
+	}
+
+	t.Run("count changed", func(t *testing.T) {
+		a := NewAssembler(0)
+		if _, err := a.Add(header(0, 3)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Add(header(1, 4)); err == nil {
+			t.Fatal("expected an error")
+		}
+		if a.Pending() != 0 {
+			t.Fatal("inconsistent set still pending")
+		}
+	})
+}
+
+func TestAssemblerEvict(t *testing.T) {
+	a := NewAssembler(20 * time.Millisecond)
+	chunks := mustChunks(t, payload(2000), 1)
+	if _, err := a.Add(chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.Evict(); n != 0 {
+		t.Fatalf("evicted %d fresh sets", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := a.Evict(); n != 1 {
+		t.Fatalf("evicted %d sets, want 1", n)
+	}
+	// the rest of the evicted set starts a new, incomplete one
+	for _, c := range chunks[1:] {
+		if out, err := a.Add(c); err != nil || out != nil {
+			t.Fatalf("Add = %v, %v", out, err)
+		}
+	}
+	if a.Pending() != 1 {
+		t.Fatalf("%d sets pending, want 1", a.Pending())
+	}
+}
+
+func TestAssemblerLimits(t *testing.T) {
+	t.Run("max pending", func(t *testing.T) {
+		a := NewAssemblerWithOptions(AssemblerOptions{Timeout: time.Minute, MaxPending: 2})
+		sets := [][][]byte{mustChunks(t, payload(2000), 1), mustChunks(t, payload(2000), 2), mustChunks(t, payload(2000), 3)}
+		for _, chunks := range sets {
+			if _, err := a.Add(chunks[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if a.Pending() != 2 {
+			t.Fatalf("%d sets pending, want 2", a.Pending())
+		}
+		// the oldest set was dropped, the newest ones complete
+		for _, chunks := range sets[1:] {
+			var out []byte
+			for _, c := range chunks[1:] {
+				var err error
+				if out, err = a.Add(c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out == nil {
+				t.Fatal("recent set dropped")
+			}
+		}
+	})
+	t.Run("max pending bytes", func(t *testing.T) {
+		first, second := mustChunks(t, payload(5000), 1), mustChunks(t, payload(5000), 2)
+		a := NewAssemblerWithOptions(AssemblerOptions{Timeout: time.Minute, MaxPendingBytes: len(first[0]) + len(second[0])})
+		for _, d := range [][]byte{first[0], first[1], second[0]} {
+			if _, err := a.Add(d); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if a.Pending() != 1 {
+			t.Fatalf("%d sets pending, want the newest only", a.Pending())
+		}
+		// a single message above the limit is refused
+		if _, err := a.Add(second[1]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Add(second[2]); err == nil {
+			t.Fatal("message larger than MaxPendingBytes accepted")
+		}
+		if a.Pending() != 0 {
+			t.Fatalf("%d sets pending, want none", a.Pending())
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package gelf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	// ChunkSize default chunk size, fits a 1500 bytes MTU
+	ChunkSize = 1420
+	// MinChunkSize smallest chunk size accepted
+	MinChunkSize = 512
+	// MaxChunkSize largest udp payload over IPv4
+	MaxChunkSize = 65507
+	// MaxChunks graylog drops messages split in more chunks
+	MaxChunks = 128
+	// ChunkHeaderLen magic bytes, message id, sequence number and count
+	ChunkHeaderLen = 12
+)
+
+var magicChunked = []byte{0x1e, 0x0f}
+
+// IsChunked reports whether the datagram starts with the GELF chunk magic bytes
+func IsChunked(datagram []byte) bool {
+	return bytes.HasPrefix(datagram, magicChunked)
+}
+
+// NumChunks returns the number of chunks of chunkSize bytes necessary to
+// transmit a payload of size bytes
+func NumChunks(size, chunkSize int) int {
+	dataLen := chunkSize - ChunkHeaderLen
+	if size <= chunkSize {
+		return 1
+	} else if size%dataLen == 0 {
+		return size / dataLen
+	} else {
+		return size/dataLen + 1
+	}
+}
+
+// Chunks splits payload into datagrams of at most chunkSize bytes, each
+// carrying the chunk header with the message id. A payload fitting in one
+// datagram is returned as is, unchunked.
+func Chunks(payload []byte, chunkSize int, id [8]byte) ([][]byte, error) {
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("invalid chunk size %d, expected %d to %d", chunkSize, MinChunkSize, MaxChunkSize)
+	}
+	count := NumChunks(len(payload), chunkSize)
+	if count > MaxChunks {
+		return nil, fmt.Errorf("msg too large, would need %d chunks", count)
+	}
+	if count == 1 {
+		return [][]byte{payload}, nil
+	}
+
+	// 所有分片共用一块内存
+	dataLen := chunkSize - ChunkHeaderLen
+	buf := make([]byte, 0, len(payload)+count*ChunkHeaderLen)
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		start := len(buf)
+		// the spec only deals in individual bytes, no byte order to care about
+		buf = append(buf, magicChunked...)
+		buf = append(buf, id[:]...)
+		buf = append(buf, byte(i), byte(count))
+		off := i * dataLen
+		end := off + dataLen
+		if end > len(payload) {
+			end = len(payload)
+		}
+		buf = append(buf, payload[off:end]...)
+		chunks = append(chunks, buf[start:len(buf):len(buf)])
+	}
+	return chunks, nil
+}
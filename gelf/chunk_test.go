@@ -0,0 +1,105 @@
+package gelf
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// payload 生成不可压缩的随机内容
+func payload(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func TestNumChunks(t *testing.T) {
+	tests := []struct {
+		size, chunkSize, want int
+	}{
+		{0, ChunkSize, 1},
+		{ChunkSize, ChunkSize, 1},
+		{ChunkSize + 1, ChunkSize, 2},
+		{2 * (ChunkSize - ChunkHeaderLen), ChunkSize, 2},
+		{2*(ChunkSize-ChunkHeaderLen) + 1, ChunkSize, 3},
+		{10000, MinChunkSize, 20},
+	}
+	for _, tt := range tests {
+		if got := NumChunks(tt.size, tt.chunkSize); got != tt.want {
+			t.Errorf("NumChunks(%d, %d) = %d, want %d", tt.size, tt.chunkSize, got, tt.want)
+		}
+	}
+}
+
+func TestChunksRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		chunkSize int
+		chunks    int
+	}{
+		{"empty", 0, ChunkSize, 1},
+		{"fits one datagram", ChunkSize, ChunkSize, 1},
+		{"one byte over", ChunkSize + 1, ChunkSize, 2},
+		{"exact multiple", 3 * (ChunkSize - ChunkHeaderLen), ChunkSize, 3},
+		{"small chunks", 20000, MinChunkSize, 40},
+		{"largest chunks", 200000, MaxChunkSize, 4},
+		{"max chunks", MaxChunks * (MinChunkSize - ChunkHeaderLen), MinChunkSize, MaxChunks},
+	}
+	id := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := payload(tt.size)
+			chunks, err := Chunks(p, tt.chunkSize, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) != tt.chunks {
+				t.Fatalf("got %d chunks, want %d", len(chunks), tt.chunks)
+			}
+			a := NewAssembler(0)
+			var got []byte
+			for i, c := range chunks {
+				if len(c) > tt.chunkSize {
+					t.Fatalf("chunk %d has %d bytes, over %d", i, len(c), tt.chunkSize)
+				}
+				if tt.chunks > 1 && !IsChunked(c) {
+					t.Fatalf("chunk %d lacks the chunk header", i)
+				}
+				out, err := a.Add(c)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out != nil && i != len(chunks)-1 {
+					t.Fatalf("payload returned after chunk %d of %d", i, len(chunks))
+				}
+				got = out
+			}
+			if !bytes.Equal(got, p) {
+				t.Fatalf("reassembled %d bytes differ from the %d sent", len(got), len(p))
+			}
+			if a.Pending() != 0 {
+				t.Fatalf("%d sets still pending", a.Pending())
+			}
+		})
+	}
+}
+
+func TestChunksErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		chunkSize int
+	}{
+		{"chunk size too small", 100, MinChunkSize - 1},
+		{"chunk size too large", 100, MaxChunkSize + 1},
+		{"too many chunks", MaxChunks*(MinChunkSize-ChunkHeaderLen) + 1, MinChunkSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Chunks(payload(tt.size), tt.chunkSize, [8]byte{}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
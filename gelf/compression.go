@@ -0,0 +1,185 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrChunked is returned by Decode for a single GELF chunk, which must first
+// be reassembled with an Assembler
+var ErrChunked = errors.New("gelf: payload is a chunk, reassemble it first")
+
+// Compression compression of payloads. The GELF spec allows gzip and zlib,
+// zstd and snappy are extensions only understood by this package
+type Compression int
+
+const (
+	// Gzip default
+	Gzip Compression = iota
+	// Zlib for receivers only accepting zlib
+	Zlib
+	// Uncompressed raw JSON. Saves CPU on fast networks, e.g. within a datacenter
+	Uncompressed
+	// Zstd much cheaper than gzip for a similar ratio
+	Zstd
+	// Snappy cheapest, with a lower ratio. Uses the snappy framing format,
+	// which starts with a stream identifier
+	Snappy
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "zlib"
+	case Uncompressed:
+		return "none"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	}
+	return "Compression(" + strconv.Itoa(int(c)) + ")"
+}
+
+// Standard reports whether graylog inputs accept payloads compressed with c
+func (c Compression) Standard() bool {
+	return c == Gzip || c == Zlib || c == Uncompressed
+}
+
+// CheckLevel rejects levels c doesn't accept: from flate.HuffmanOnly to
+// flate.BestCompression for gzip and zlib, from 1 to 22 for zstd
+func CheckLevel(c Compression, level int) error {
+	switch c {
+	case Gzip, Zlib:
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			return fmt.Errorf("invalid compression level %d", level)
+		}
+	case Zstd:
+		if level < 1 || level > 22 {
+			return fmt.Errorf("invalid zstd compression level %d", level)
+		}
+	}
+	return nil
+}
+
+var (
+	// zstdEncoders 按级别缓存编码器，EncodeAll可并发调用
+	zstdEncoders sync.Map
+	zstdDecoder  *zstd.Decoder
+	zstdOnce     sync.Once
+)
+
+func zstdEncoder(level int) (*zstd.Encoder, error) {
+	if enc, ok := zstdEncoders.Load(level); ok {
+		return enc.(*zstd.Encoder), nil
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := zstdEncoders.LoadOrStore(level, enc)
+	return actual.(*zstd.Encoder), nil
+}
+
+func decodeZstd(b []byte) ([]byte, error) {
+	zstdOnce.Do(func() {
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+	return zstdDecoder.DecodeAll(b, nil)
+}
+
+// Compress compresses data with c at level, see CheckLevel. The level is
+// ignored by Snappy and Uncompressed
+func Compress(data []byte, c Compression, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	var err error
+	switch c {
+	case Gzip:
+		zw, err = gzip.NewWriterLevel(&buf, level)
+	case Zlib:
+		zw, err = zlib.NewWriterLevel(&buf, level)
+	case Uncompressed:
+		return data, nil
+	case Zstd:
+		if err := CheckLevel(c, level); err != nil {
+			return nil, err
+		}
+		enc, err := zstdEncoder(level)
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, nil), nil
+	case Snappy:
+		zw = s2.NewWriter(&buf, s2.WriterSnappyCompat(), s2.WriterConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unknown compression %s", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(data); err != nil {
+		return nil, err
+	}
+	// ensure all data is written
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// snappyStreamMagic snappy framing format stream identifier chunk
+var snappyStreamMagic = []byte("\xff\x06\x00\x00sNaPpY")
+
+// zstdMagic zstd frame magic number, little endian 0xFD2FB528
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Decode detects the compression of a received GELF payload from its magic
+// bytes and returns the plain JSON: gzip, zlib, zstd, snappy (framed) and
+// uncompressed JSON are accepted.
+func Decode(b []byte) ([]byte, error) {
+	switch {
+	case len(b) == 0:
+		return nil, errors.New("gelf: empty payload")
+	case IsChunked(b):
+		return nil, ErrChunked
+	case len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b:
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case len(b) >= 2 && b[0]&0x0f == 0x08 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0:
+		zr, err := zlib.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case bytes.HasPrefix(b, zstdMagic):
+		return decodeZstd(b)
+	case bytes.HasPrefix(b, snappyStreamMagic):
+		return io.ReadAll(s2.NewReader(bytes.NewReader(b)))
+	}
+
+	if trimmed := bytes.TrimLeft(b, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return b, nil
+	}
+	magic := b
+	if len(magic) > 2 {
+		magic = magic[:2]
+	}
+	return nil, fmt.Errorf("gelf: unknown payload encoding (magic % x)", magic)
+}
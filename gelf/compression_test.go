@@ -0,0 +1,144 @@
+package gelf
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"testing"
+)
+
+func TestCompressDecode(t *testing.T) {
+	data := []byte(`{"version":"1.1","host":"h","short_message":"hello","level":6,"_n":1}`)
+	tests := []struct {
+		c     Compression
+		level int
+	}{
+		{Gzip, flate.BestSpeed},
+		{Gzip, flate.BestCompression},
+		{Gzip, flate.HuffmanOnly},
+		{Zlib, flate.DefaultCompression},
+		{Zlib, flate.BestCompression},
+		{Uncompressed, 0},
+		{Zstd, 1},
+		{Zstd, 22},
+		{Snappy, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.c.String(), func(t *testing.T) {
+			b, err := Compress(data, tt.c, tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("Decode = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestCheckLevel(t *testing.T) {
+	tests := []struct {
+		c     Compression
+		level int
+		ok    bool
+	}{
+		{Gzip, flate.HuffmanOnly, true},
+		{Gzip, flate.BestCompression, true},
+		{Gzip, flate.HuffmanOnly - 1, false},
+		{Zlib, flate.BestCompression + 1, false},
+		{Zstd, 1, true},
+		{Zstd, 0, false},
+		{Zstd, 23, false},
+		{Snappy, 100, true},
+		{Uncompressed, -100, true},
+	}
+	for _, tt := range tests {
+		if err := CheckLevel(tt.c, tt.level); (err == nil) != tt.ok {
+			t.Errorf("CheckLevel(%s, %d) = %v", tt.c, tt.level, err)
+		}
+	}
+}
+
+func TestCompressUnknown(t *testing.T) {
+	if _, err := Compress([]byte("{}"), Compression(42), 0); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	gz, err := Compress([]byte(`{"short_message":"x"}`), Gzip, flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"unknown magic", []byte("hello")},
+		{"single byte", []byte{0x1f}},
+		{"truncated gzip", gz[:len(gz)/2]},
+		{"gzip header only", []byte{0x1f, 0x8b}},
+		{"zlib header only", []byte{0x78, 0x9c}},
+		{"corrupt zstd", append(append([]byte(nil), zstdMagic...), 0xff, 0xff, 0xff)},
+		{"corrupt snappy", append(append([]byte(nil), snappyStreamMagic...), 0x00, 0x05, 0x00)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.payload); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	t.Run("chunk", func(t *testing.T) {
+		chunk := append([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, 0, 2}, "data"...)
+		if _, err := Decode(chunk); !errors.Is(err, ErrChunked) {
+			t.Fatalf("Decode = %v, want ErrChunked", err)
+		}
+	})
+}
+
+func TestDecodeJSONWhitespace(t *testing.T) {
+	p := []byte("\r\n\t {\"short_message\":\"x\"}")
+	got, err := Decode(p)
+	if err != nil || !bytes.Equal(got, p) {
+		t.Fatalf("Decode = %q, %v", got, err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	data := []byte(`{"version":"1.1","host":"h","short_message":"hello"}`)
+	for _, c := range []Compression{Gzip, Zlib, Uncompressed, Zstd, Snappy} {
+		level := flate.BestSpeed
+		if c == Zstd {
+			level = 3
+		}
+		b, err := Compress(data, c, level)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0x1e, 0x0f, 1, 2, 3, 4, 5, 6, 7, 8, 0, 2})
+	f.Add([]byte{0x1f, 0x8b, 0x08})
+	f.Add([]byte{0x78, 0x9c, 0x00})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		out, err := Decode(b)
+		if err != nil {
+			return
+		}
+		// whatever decodes is stable: plain JSON decodes to itself
+		if trimmed := bytes.TrimLeft(out, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+			again, err := Decode(out)
+			if err != nil || !bytes.Equal(again, out) {
+				t.Fatalf("decoded JSON doesn't decode to itself: %v", err)
+			}
+		}
+	})
+}
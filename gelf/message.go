@@ -0,0 +1,180 @@
+// Package gelf implements the GELF wire format: messages, payload compression
+// and udp chunking. It has no dependency on logrus, so agents and relays can
+// reuse it on their own.
+package gelf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Message A GELF message is a JSON string with the following fields:
+// https://go2docs.graylog.org/5-0/getting_in_log_data/gelf.html#GELFPayloadSpecification
+type Message struct {
+	Version  string  `json:"version"`
+	Host     string  `json:"host"`
+	Short    string  `json:"short_message"`
+	Full     string  `json:"full_message"`
+	TimeUnix float64 `json:"timestamp"`
+	Level    int32   `json:"level"`
+	// Facility @Deprecated send as additional field instead
+	Facility string `json:"facility"`
+	// Line @Deprecated send as additional field instead
+	Line int `json:"line"`
+	// File @Deprecated send as additional field instead
+	File  string                 `json:"file"`
+	Extra map[string]interface{} `json:"-"`
+}
+
+const (
+	Version10 = "1.0"
+	Version11 = "1.1"
+)
+
+// DefaultLevel level of a received message without one, ALERT per the GELF spec
+const DefaultLevel = 1
+
+type innerMessage Message // against circular (Un)MarshalJSON
+
+// innerMessageV11 payload shape of GELF 1.1, the deprecated fields are only
+// sent when set
+type innerMessageV11 struct {
+	Version  string                 `json:"version"`
+	Host     string                 `json:"host"`
+	Short    string                 `json:"short_message"`
+	Full     string                 `json:"full_message"`
+	TimeUnix float64                `json:"timestamp"`
+	Level    int32                  `json:"level"`
+	Facility string                 `json:"facility,omitempty"`
+	Line     int                    `json:"line,omitempty"`
+	File     string                 `json:"file,omitempty"`
+	Extra    map[string]interface{} `json:"-"`
+}
+
+func (m *Message) MarshalJSON() ([]byte, error) {
+	var err error
+	var b, eb []byte
+
+	extra := m.Extra
+	if m.Version == Version11 {
+		b, err = json.Marshal((*innerMessageV11)(m))
+	} else {
+		// 1.0 and unknown versions always carry facility, file and line
+		b, err = json.Marshal((*innerMessage)(m))
+	}
+	m.Extra = extra
+	if err != nil {
+		return nil, err
+	}
+
+	if len(extra) == 0 {
+		return b, nil
+	}
+
+	if eb, err = json.Marshal(extra); err != nil {
+		return nil, err
+	}
+
+	// merge serialized message + serialized extra map
+	b[len(b)-1] = ','
+	return append(b, eb[1:]...), nil
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	// numbers are decoded as json.Number so large integers in additional
+	// fields survive a round-trip without float64 precision loss. timestamp is
+	// the exception: TimeUnix stays a float64, which keeps about a microsecond
+	// of precision for current dates, finer digits are rounded
+	i := make(map[string]interface{}, 16)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&i); err != nil {
+		return err
+	}
+	hasLevel := false
+	for k, v := range i {
+		if k == "" {
+			return fmt.Errorf("gelf: empty field name")
+		}
+		if k[0] == '_' {
+			if m.Extra == nil {
+				m.Extra = make(map[string]interface{}, 1)
+			}
+			m.Extra[k] = v
+			continue
+		}
+		var err error
+		switch k {
+		case "version":
+			m.Version, err = stringField(k, v)
+		case "host":
+			m.Host, err = stringField(k, v)
+		case "short_message":
+			m.Short, err = stringField(k, v)
+		case "full_message":
+			m.Full, err = stringField(k, v)
+		case "timestamp":
+			m.TimeUnix, err = numberField(k, v)
+		case "level":
+			var level int64
+			level, err = intField(k, v)
+			m.Level = int32(level)
+			hasLevel = v != nil
+		case "facility":
+			m.Facility, err = stringField(k, v)
+		case "file":
+			m.File, err = stringField(k, v)
+		case "line":
+			var line int64
+			line, err = intField(k, v)
+			m.Line = int(line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !hasLevel {
+		m.Level = DefaultLevel
+	}
+	return nil
+}
+
+// stringField 字段值必须是字符串，null视为空
+func stringField(k string, v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("gelf: field %q must be a string, got %T", k, v)
+	}
+}
+
+// numberField 字段值必须是数字，null视为0
+func numberField(k string, v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("gelf: field %q: %w", k, err)
+		}
+		return f, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("gelf: field %q must be a number, got %T", k, v)
+	}
+}
+
+// intField 整数字段，兼容以小数形式发送的整数(如 6.0)
+func intField(k string, v interface{}) (int64, error) {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+	}
+	f, err := numberField(k, v)
+	return int64(f), err
+}
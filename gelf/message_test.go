@@ -0,0 +1,191 @@
+package gelf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      Message
+		has    []string
+		hasNot []string
+	}{
+		{
+			name:   "1.1 omits unset deprecated fields",
+			m:      Message{Version: Version11, Host: "h", Short: "s", Level: 6},
+			has:    []string{`"version":"1.1"`, `"level":6`},
+			hasNot: []string{`"facility"`, `"line"`, `"file"`},
+		},
+		{
+			name: "1.0 keeps deprecated fields",
+			m:    Message{Version: Version10, Host: "h", Short: "s"},
+			has:  []string{`"facility":""`, `"line":0`, `"file":""`},
+		},
+		{
+			name: "additional fields are merged",
+			m:    Message{Version: Version11, Extra: map[string]interface{}{"_a": 1, "_b": "x"}},
+			has:  []string{`"_a":1`, `"_b":"x"`, `"short_message":""`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(&tt.m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := string(b)
+			if !json.Valid(b) {
+				t.Fatalf("invalid JSON %s", s)
+			}
+			for _, want := range tt.has {
+				if !strings.Contains(s, want) {
+					t.Errorf("%s lacks %s", s, want)
+				}
+			}
+			for _, unwanted := range tt.hasNot {
+				if strings.Contains(s, unwanted) {
+					t.Errorf("%s has %s", s, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	m := Message{
+		Version:  Version11,
+		Host:     "h",
+		Short:    "short",
+		Full:     "full",
+		TimeUnix: 1700000000.123,
+		Level:    3,
+		Extra:    map[string]interface{}{"_id_": "x", "_big": json.Number("9007199254740993")},
+	}
+	b, err := json.Marshal(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Message
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Host != m.Host || got.Short != m.Short || got.Full != m.Full || got.TimeUnix != m.TimeUnix || got.Level != m.Level {
+		t.Fatalf("got %+v, want %+v", got, m)
+	}
+	if got.Extra["_big"] != json.Number("9007199254740993") || got.Extra["_id_"] != "x" {
+		t.Fatalf("additional fields %v", got.Extra)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Message
+		wantErr bool
+	}{
+		{
+			name:    "full message",
+			payload: `{"version":"1.1","host":"h","short_message":"s","full_message":"f","timestamp":1.5,"level":3,"facility":"fa","file":"x.go","line":7,"_a":"b"}`,
+			want:    Message{Version: Version11, Host: "h", Short: "s", Full: "f", TimeUnix: 1.5, Level: 3, Facility: "fa", File: "x.go", Line: 7, Extra: map[string]interface{}{"_a": "b"}},
+		},
+		{
+			name:    "missing level",
+			payload: `{"version":"1.1","host":"h","short_message":"s"}`,
+			want:    Message{Version: Version11, Host: "h", Short: "s", Level: DefaultLevel},
+		},
+		{
+			name:    "null level",
+			payload: `{"short_message":"s","level":null}`,
+			want:    Message{Short: "s", Level: DefaultLevel},
+		},
+		{
+			name:    "level 0 is kept",
+			payload: `{"short_message":"s","level":0}`,
+			want:    Message{Short: "s", Level: 0},
+		},
+		{
+			name:    "integral float level",
+			payload: `{"level":6.0}`,
+			want:    Message{Level: 6},
+		},
+		{
+			name:    "null strings",
+			payload: `{"host":null,"short_message":null,"level":5}`,
+			want:    Message{Level: 5},
+		},
+		{name: "string level", payload: `{"level":"6"}`, wantErr: true},
+		{name: "number host", payload: `{"host":1}`, wantErr: true},
+		{name: "string timestamp", payload: `{"timestamp":"now"}`, wantErr: true},
+		{name: "empty field name", payload: `{"":1}`, wantErr: true},
+		{name: "array", payload: `[1,2]`, wantErr: true},
+		{name: "truncated", payload: `{"host":"h"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Message
+			err := json.Unmarshal([]byte(tt.payload), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != tt.want.Version || got.Host != tt.want.Host || got.Short != tt.want.Short ||
+				got.Full != tt.want.Full || got.TimeUnix != tt.want.TimeUnix || got.Level != tt.want.Level ||
+				got.Facility != tt.want.Facility || got.File != tt.want.File || got.Line != tt.want.Line ||
+				len(got.Extra) != len(tt.want.Extra) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for k, v := range tt.want.Extra {
+				if got.Extra[k] != v {
+					t.Fatalf("field %s = %v, want %v", k, got.Extra[k], v)
+				}
+			}
+		})
+	}
+}
+
+func FuzzUnmarshalJSON(f *testing.F) {
+	for _, seed := range []string{
+		`{"version":"1.1","host":"h","short_message":"s","full_message":"f","timestamp":1700000000.5,"level":6,"_a":"b","_n":12345678901234567890}`,
+		`{"version":"1.0","host":"h","short_message":"s","facility":"f","file":"x.go","line":10}`,
+		`{"short_message":"s"}`,
+		`{"level":null,"host":null}`,
+		`{"level":1e400}`,
+		`{"line":-1.5}`,
+		`{"_nested":{"a":[1,2,{"b":null}]}}`,
+		`{"":1}`,
+		`{"level":"1"}`,
+		`[]`,
+		`null`,
+		`{`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m Message
+		if err := m.UnmarshalJSON(data); err != nil {
+			return
+		}
+		// an accepted message marshals to JSON that decodes to the same fields
+		b, err := json.Marshal(&m)
+		if err != nil {
+			return
+		}
+		var again Message
+		if err := json.Unmarshal(b, &again); err != nil {
+			t.Fatalf("re-decoding %s: %v", b, err)
+		}
+		if again.Level != m.Level || again.Host != m.Host || again.Short != m.Short || len(again.Extra) != len(m.Extra) {
+			t.Fatalf("round trip changed %+v to %+v", m, again)
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package graylog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type APIOptions struct {
+	// URL graylog REST API, e.g. https://graylog:9000/api
+	URL string
+	// Username and Password of a graylog user allowed to read inputs and streams
+	Username string
+	Password string
+	// Token access token, used instead of Username and Password
+	Token string
+	// Client used to send requests, default a client with a 10s timeout
+	Client *http.Client
+}
+
+// APIClient reads graylog's REST API, to check at startup that messages will
+// end up somewhere, see Validate
+type APIClient struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+// APIInput an input configured in graylog
+type APIInput struct {
+	ID         string                 `json:"id"`
+	Title      string                 `json:"title"`
+	Type       string                 `json:"type"`
+	Global     bool                   `json:"global"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// APIStream a stream configured in graylog
+type APIStream struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Disabled bool   `json:"disabled"`
+}
+
+func NewAPIClient(opts APIOptions) (*APIClient, error) {
+	base, err := url.Parse(strings.TrimSuffix(opts.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid graylog api url %q: %w", opts.URL, err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid graylog api url %q: expected e.g. https://graylog:9000/api", opts.URL)
+	}
+	c := &APIClient{
+		base:     base,
+		username: opts.Username,
+		password: opts.Password,
+		client:   opts.Client,
+	}
+	if opts.Token != "" {
+		// graylog access tokens are sent as the user name with the password "token"
+		c.username, c.password = opts.Token, "token"
+	}
+	if c.client == nil {
+		c.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return c, nil
+}
+
+func (c *APIClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base.String()+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("graylog api GET %s responded %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Inputs returns the configured inputs
+func (c *APIClient) Inputs(ctx context.Context) ([]APIInput, error) {
+	var resp struct {
+		Inputs []APIInput `json:"inputs"`
+	}
+	if err := c.get(ctx, "/system/inputs", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Inputs, nil
+}
+
+// InputStates returns the state of the inputs running on the node serving the
+// request, e.g. RUNNING or FAILED, by input id
+func (c *APIClient) InputStates(ctx context.Context) (map[string]string, error) {
+	var resp struct {
+		States []struct {
+			ID    string `json:"id"`
+			State string `json:"state"`
+		} `json:"states"`
+	}
+	if err := c.get(ctx, "/system/inputstates", &resp); err != nil {
+		return nil, err
+	}
+	states := make(map[string]string, len(resp.States))
+	for _, s := range resp.States {
+		states[s.ID] = s.State
+	}
+	return states, nil
+}
+
+// Streams returns the configured streams
+func (c *APIClient) Streams(ctx context.Context) ([]APIStream, error) {
+	var resp struct {
+		Streams []APIStream `json:"streams"`
+	}
+	if err := c.get(ctx, "/streams", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Streams, nil
+}
+
+type ValidateOptions struct {
+	// InputAddr address the hook sends to, e.g. udp://graylog:12201. An input of
+	// the matching GELF type must listen on its port
+	InputAddr string
+	// InputID id of the input the hook sends to, instead of InputAddr
+	InputID string
+	// Streams titles or ids of streams that must exist and be enabled
+	Streams []string
+}
+
+// Validate checks that the input messages are sent to exists and is running,
+// and that the required streams exist, e.g. at startup to fail fast instead of
+// sending into the void. Every problem found is reported in the returned error.
+func (c *APIClient) Validate(ctx context.Context, opts ValidateOptions) error {
+	var errs []error
+	if opts.InputAddr != "" || opts.InputID != "" {
+		errs = append(errs, c.validateInput(ctx, opts))
+	}
+	if len(opts.Streams) > 0 {
+		errs = append(errs, c.validateStreams(ctx, opts.Streams))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *APIClient) validateInput(ctx context.Context, opts ValidateOptions) error {
+	inputs, err := c.Inputs(ctx)
+	if err != nil {
+		return err
+	}
+
+	var input *APIInput
+	if opts.InputID != "" {
+		for i := range inputs {
+			if inputs[i].ID == opts.InputID {
+				input = &inputs[i]
+			}
+		}
+		if input == nil {
+			return fmt.Errorf("graylog input %s does not exist", opts.InputID)
+		}
+	} else {
+		networkType, addr, err := parseGelfAddr(opts.InputAddr, false)
+		if err != nil {
+			return err
+		}
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		// e.g. org.graylog2.inputs.gelf.udp.GELFUDPInput
+		transport := "udp"
+		if networkType.isTCP() {
+			transport = "tcp"
+		}
+		for i := range inputs {
+			if strings.Contains(inputs[i].Type, ".gelf."+transport+".") && attributePort(inputs[i].Attributes) == port {
+				input = &inputs[i]
+			}
+		}
+		if input == nil {
+			return fmt.Errorf("no graylog GELF %s input listens on port %s", transport, port)
+		}
+	}
+
+	states, err := c.InputStates(ctx)
+	if err != nil {
+		return err
+	}
+	if state := states[input.ID]; state != "RUNNING" {
+		if state == "" {
+			state = "not started"
+		}
+		return fmt.Errorf("graylog input %q (%s) is %s", input.Title, input.ID, state)
+	}
+	return nil
+}
+
+// attributePort the port attribute of an input, as a string
+func attributePort(attributes map[string]interface{}) string {
+	switch p := attributes["port"].(type) {
+	case float64:
+		return strconv.Itoa(int(p))
+	case string:
+		return p
+	}
+	return ""
+}
+
+func (c *APIClient) validateStreams(ctx context.Context, required []string) error {
+	streams, err := c.Streams(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range required {
+		var found *APIStream
+		for i := range streams {
+			if streams[i].Title == name || streams[i].ID == name {
+				found = &streams[i]
+			}
+		}
+		switch {
+		case found == nil:
+			errs = append(errs, fmt.Errorf("graylog stream %q does not exist", name))
+		case found.Disabled:
+			errs = append(errs, fmt.Errorf("graylog stream %q is paused", name))
+		}
+	}
+	return errors.Join(errs...)
+}
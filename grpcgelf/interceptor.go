@@ -0,0 +1,102 @@
+// Package grpcgelf provides grpc server interceptors logging one entry per RPC,
+// to be sent to graylog by a logger with the graylog hook attached.
+package grpcgelf
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type Options struct {
+	// Logger receives one entry per RPC, with the graylog hook attached.
+	// default logrus.StandardLogger()
+	Logger logrus.FieldLogger
+	// Skip RPCs not to log by full method name, e.g. health checks
+	Skip func(fullMethod string) bool
+}
+
+// UnaryServerInterceptor logs every unary RPC with the fields _grpc_service,
+// _grpc_method, _grpc_code, _duration_ms and _peer. A returned error is logged
+// as the error field, so the hook adds its stack trace when it has one.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	opts = withDefaults(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if opts.Skip != nil && opts.Skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRPC(ctx, opts.Logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs every streaming RPC once it ended, with the
+// fields of UnaryServerInterceptor
+func StreamServerInterceptor(opts Options) grpc.StreamServerInterceptor {
+	opts = withDefaults(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if opts.Skip != nil && opts.Skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		start := time.Now()
+		err := handler(srv, ss)
+		logRPC(ss.Context(), opts.Logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func withDefaults(opts Options) Options {
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	return opts
+}
+
+func logRPC(ctx context.Context, logger logrus.FieldLogger, fullMethod string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := logrus.Fields{
+		"grpc_service": path.Dir(fullMethod)[1:],
+		"grpc_method":  path.Base(fullMethod),
+		"grpc_code":    code.String(),
+		"duration_ms":  float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["peer"] = p.Addr.String()
+	}
+	entry := logger.WithFields(fields)
+	if err != nil {
+		entry = entry.WithError(err)
+	}
+
+	msg := "finished call " + fullMethod + " with code " + code.String()
+	switch level(code) {
+	case logrus.ErrorLevel:
+		entry.Error(msg)
+	case logrus.WarnLevel:
+		entry.Warn(msg)
+	default:
+		entry.Info(msg)
+	}
+}
+
+// level 客户端导致的错误为warn，服务端错误为error
+func level(code codes.Code) logrus.Level {
+	switch code {
+	case codes.OK:
+		return logrus.InfoLevel
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange:
+		return logrus.WarnLevel
+	default:
+		return logrus.ErrorLevel
+	}
+}
@@ -3,20 +3,53 @@ package graylog
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type Hook struct {
-	extra       map[string]interface{}
+	// extra, level and sampleRate can change at runtime, see ApplyConfig
+	extra       atomic.Pointer[map[string]interface{}]
+	level       atomic.Uint32
+	sampleRate  atomic.Uint64
 	host        string
-	level       logrus.Level
-	backend     Backend
+	backend     atomic.Pointer[sharedBackend]
 	synchronous bool
-	queue       *BlockingList
+	queue       Queue
+	// durable the queue stores messages built by Fire, see durableQueue
+	durable bool
+	// spill synchronous sends exceeding SendTimeout, nil when disabled
+	spill *spillQueue
+	// opts options the hook was created with, defaults applied
+	opts HookOptions
+	// workerBackends backends created by HookOptions.BackendFactory, one per worker
+	workerBackends   []Backend
+	workerBackendsMu sync.Mutex
+	// pending number of async entries queued or being sent
+	pending atomic.Int64
+	// workers number of running async workers
+	workers atomic.Int64
+	// sendNanos and sendCount accumulate send latency for adaptive concurrency
+	sendNanos atomic.Int64
+	sendCount atomic.Int64
+	// lastDequeued enqueue time, in unix nanoseconds, of the entry a worker took last
+	lastDequeued atomic.Int64
+	created      time.Time
+	mutes        muteRules
+	// levelExtra LevelExtra merged for each level
+	levelExtra map[logrus.Level]map[string]interface{}
+	// outage nil unless HookOptions.OutageSummary
+	outage *outageTracker
+	// levels fired to the hook, see HookOptions.LevelMapping
+	levels []logrus.Level
 }
 
 type gelfEntry struct {
@@ -27,75 +60,396 @@ type gelfEntry struct {
 	Line     int
 	Function string
 	Time     time.Time
+	// Enqueued when the entry was queued, zero for synchronous sends
+	Enqueued time.Time
 }
 
 type HookOptions struct {
-	Backend     Backend
-	Extra       map[string]interface{}
+	Backend Backend
+	// BackendFactory when set, each async worker creates its own backend with it
+	// (e.g. one tcp connection per worker) instead of sharing Backend. Synchronous
+	// hooks create a single backend when Backend is nil.
+	BackendFactory func() (Backend, error)
+	Extra          map[string]interface{}
+	// LevelExtra additional fields added to the entries of a level and of the
+	// more severe levels, e.g. {logrus.ErrorLevel: {"oncall": true}} tags error,
+	// fatal and panic entries, for graylog alert routing. When several levels
+	// set a field, the most severe wins. Entry data overrides these fields
+	LevelExtra  map[logrus.Level]map[string]interface{}
 	Synchronous bool
-	// Concurrency is the number of goroutines to use when sending messages to the backend,default 100
+	// Concurrency is the number of goroutines to use when sending messages to
+	// the backend. default from GOMAXPROCS and the backend: 2 for a gelf
+	// backend, whose single socket serializes sends, 4 x GOMAXPROCS for pooled
+	// backends such as http and redis, 2 x GOMAXPROCS with a BackendFactory
 	Concurrency int
+	// Stream default value of the _stream field, for entries not tagged by WithStream or ContextWithStream
+	Stream string
+	// LegacyFields fill the deprecated GELF fields facility, file and line, for
+	// old graylog inputs that still expect them
+	LegacyFields bool
+	// Facility value of the facility field when LegacyFields is enabled
+	Facility string
+	// Version GELF version sent in the version field, GELFVersion10 or GELFVersion11.
+	// 1.1 omits the deprecated fields when they are empty. default GELFVersion11
+	Version string
+	// FatalTimeout bounds the time spent sending panic and fatal entries, which
+	// bypass the queue and are sent immediately. default 3s
+	FatalTimeout time.Duration
+	// FallbackWriter receives panic and fatal entries, as GELF JSON lines, when
+	// they can't be sent within FatalTimeout. default os.Stderr
+	FallbackWriter io.Writer
+	// ExitGracePeriod when positive, registers a logrus exit handler giving queued
+	// messages up to this long to be sent when the process exits through
+	// logrus.Exit or Fatal. Go runs no hook when main returns, call FlushAndClose
+	// there. default 0 (disabled)
+	ExitGracePeriod time.Duration
+	// DrainProgress is called every DrainProgressInterval while Flush,
+	// FlushTimeout or FlushAndClose wait for queued messages, e.g. to log
+	// shutdown progress
+	DrainProgress func(remaining int, elapsed time.Duration)
+	// DrainProgressInterval default 1s
+	DrainProgressInterval time.Duration
+	// AdaptiveConcurrency scales the number of async workers between
+	// MinConcurrency and MaxConcurrency from the queue depth and send latency,
+	// instead of running Concurrency workers. default false
+	AdaptiveConcurrency bool
+	// MinConcurrency lower bound of adaptive workers, default 1
+	MinConcurrency int
+	// MaxConcurrency upper bound of adaptive workers, default Concurrency
+	MaxConcurrency int
+	// FieldTypes forces the type of additional fields, keyed by field name as
+	// logged, e.g. {"status": FieldTypeNumber, "order_id": FieldTypeString},
+	// avoiding mapping conflicts in graylog's elasticsearch indices
+	FieldTypes map[string]FieldType
+	// HashedFields additional fields, by name as logged, whose values are
+	// replaced by their sha256 so that sensitive values stay correlatable
+	// without being readable, e.g. {"user_email"}
+	HashedFields []string
+	// HashSalt prepended to values before hashing, makes dictionary attacks on
+	// hashed fields harder
+	HashSalt string
+	// BucketedFields numeric fields replaced by the range of the sorted bounds
+	// they fall in, e.g. {"amount": {10, 100, 1000}} sends "10-100" for 42
+	BucketedFields map[string][]float64
+	// StampMessageID adds a _message_id, so consumers and graylog pipelines
+	// can deduplicate retried messages. It hashes the message like MessageID
+	// plus a per-process random value and a counter: the copies of a message
+	// retried over several transports share the id, identical messages logged
+	// twice don't
+	StampMessageID bool
+	// MessageIDFields additional fields included in the message id, by name as logged
+	MessageIDFields []string
+	// DisableTimeNormalization sends time.Duration and time.Time field values
+	// as encoding/json encodes them. By default a duration field d is sent as
+	// the number of milliseconds in _d_ms, so dashboards can aggregate it, and
+	// times are formatted with TimeFormat
+	DisableTimeNormalization bool
+	// TimeFormat layout of time.Time field values, default time.RFC3339Nano
+	TimeFormat string
+	// MaxFields maximum number of additional fields per message, graylog's
+	// elasticsearch mappings don't cope with unbounded dynamic fields. Fields
+	// beyond the limit, last by name first, are folded into _extra_overflow as a
+	// JSON string. default 0 (unlimited)
+	MaxFields int
+	// MaxMessageSize maximum size in bytes of the JSON encoded message. The
+	// largest additional fields are folded into _extra_overflow, truncated
+	// when needed, until the message fits. default 0 (unlimited)
+	MaxMessageSize int
+	// PipelineNotes records in _pipeline_notes what the hook changed in a
+	// message: hashed, bucketed, coerced, renamed or folded fields, so what is
+	// seen in graylog can be trusted and debugged. The notes are added after
+	// MaxMessageSize was enforced. default false
+	PipelineNotes bool
+	// FieldPrefix namespace prepended to the additional fields from Extra and
+	// entry data, e.g. "payments." sends status as _payments.status, so components
+	// sharing a process don't collide on generic names. A "." separator is
+	// appended to a prefix not ending with punctuation, and only the fields
+	// starting with the prefix and its separator are considered already
+	// prefixed. Fields are configured in FieldTypes, HashedFields etc. by their
+	// name as logged, without the prefix
+	FieldPrefix string
+	// DisableErrorChain don't send _error_chain. By default, when the error
+	// field wraps other errors, e.g. with fmt.Errorf("%w") or errors.Join, every
+	// error of the chain is sent in _error_chain as an array of {type, message}
+	DisableErrorChain bool
+	// SendTimeout bounds the time Fire waits for a synchronous send, e.g. 50ms.
+	// A slower send goes on in the background, and the following messages are
+	// queued behind it in a spill queue until it drained, so a degraded backend
+	// doesn't stall the caller. Flush waits for the spill queue. default 0 (wait)
+	SendTimeout time.Duration
+	// SpillQueueSize capacity of the spill queue, Fire returns
+	// ErrSpillQueueFull when it is full. default 1000
+	SpillQueueSize int
+	// ClockOffset added to the timestamp of every message, correcting a host
+	// clock known to drift. The offset applied is sent in _clock_offset_ms
+	ClockOffset time.Duration
+	// ClockOffsetFunc returns the offset to apply instead of ClockOffset, e.g.
+	// measured against an NTP server. It is called for every message, so it
+	// should return a cached value
+	ClockOffsetFunc func() time.Duration
+	// QueueShards when greater than 1, the async queue is split into this many
+	// shards with work-stealing workers, for very high concurrent logging rates.
+	// Ordering is then only kept per shard. default 0 (single lock-free queue)
+	QueueShards int
+	// Queue stores the entries waiting for the async workers instead of the
+	// default queue, e.g. NewRingQueue for a bounded queue, NewDiskQueue or
+	// NewRedisQueue for messages surviving a restart, NewBlockingList or a
+	// custom implementation. It must not be shared between hooks, QueueShards
+	// is ignored. The messages a durable queue holds when the hook is created
+	// are sent by the workers and waited for by Flush
+	Queue Queue
+	// OutageSummary after the backend failed to send messages, sends one
+	// warning tagged with OutageKey as soon as a send succeeds again, with the
+	// outage window, the number of messages dropped, still queued and the
+	// reconnect attempts, so the gap in graylog explains itself. A backend
+	// retrying until it succeeds, e.g. the gelf backend without
+	// MaxReconnectAttempts, reports no failure: see GelfOptions.OnReconnect.
+	// default false
+	OutageSummary bool
+	// Schema expected type of additional fields, checked before sending so
+	// that a field flipping type doesn't break graylog's elasticsearch mappings
+	Schema *FieldSchema
+	// SchemaAction what to do with a field not matching Schema, default SchemaCoerce
+	SchemaAction SchemaAction
+	// OnSchemaViolation is called for every field not matching Schema, e.g. to
+	// count them. default logs violations through the internal logger when
+	// SchemaAction is SchemaWarn
+	OnSchemaViolation func(SchemaViolation)
+	// StampEnqueuedAt adds EnqueuedAtKey, the time the hook queued the
+	// message, so that a Bridge with TransportLatency can measure how long the
+	// message took to reach it. default false
+	StampEnqueuedAt bool
+	// LevelMapping syslog level sent for logrus levels, overriding the default
+	// mapping, e.g. {logrus.InfoLevel: LogNotice}. Custom levels beyond
+	// logrus.TraceLevel, e.g. logrus.TraceLevel + 1, are only fired to the hook
+	// when mapped here, they are filtered by SetLevel and sampled like the
+	// logrus level closest to their syslog level
+	LevelMapping map[logrus.Level]int32
+	// FallbackLevel syslog level of the logrus levels neither logrus nor
+	// LevelMapping know, default LogDebug. LogEmerg can only be set through
+	// LevelMapping. logrus only fires the levels returned by Hook.Levels:
+	// list the custom levels sent with FallbackLevel in CustomLevels
+	FallbackLevel int32
+	// CustomLevels custom logrus levels, beyond TraceLevel, fired to the hook
+	// and sent with FallbackLevel, in addition to those of LevelMapping
+	CustomLevels []logrus.Level
 }
 
 func NewHook(opts HookOptions) *Hook {
 	if opts.Concurrency <= 0 {
-		opts.Concurrency = 100
+		opts.Concurrency = defaultConcurrency(opts)
+	}
+	if opts.Version == "" {
+		opts.Version = GELFVersion11
+	}
+	if opts.FatalTimeout <= 0 {
+		opts.FatalTimeout = 3 * time.Second
+	}
+	if opts.FallbackWriter == nil {
+		opts.FallbackWriter = os.Stderr
+	}
+	if opts.DrainProgressInterval <= 0 {
+		opts.DrainProgressInterval = time.Second
+	}
+	if opts.SpillQueueSize <= 0 {
+		opts.SpillQueueSize = 1000
+	}
+	if opts.FallbackLevel == 0 {
+		opts.FallbackLevel = LogDebug
+	}
+	opts.FieldPrefix = fieldPrefix(opts.FieldPrefix)
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = time.RFC3339Nano
+	}
+	if opts.MinConcurrency <= 0 {
+		opts.MinConcurrency = 1
+	}
+	if opts.MaxConcurrency <= 0 {
+		opts.MaxConcurrency = opts.Concurrency
+	}
+	if opts.MaxConcurrency < opts.MinConcurrency {
+		opts.MaxConcurrency = opts.MinConcurrency
+	}
+	if opts.BucketedFields != nil {
+		// sorted copy, the caller's map is left untouched
+		buckets := make(map[string][]float64, len(opts.BucketedFields))
+		for name, bounds := range opts.BucketedFields {
+			sorted := append([]float64(nil), bounds...)
+			sort.Float64s(sorted)
+			buckets[name] = sorted
+		}
+		opts.BucketedFields = buckets
 	}
 	host, err := os.Hostname()
 	if err != nil {
 		host = "localhost"
 	}
-	var queue *BlockingList
+	if opts.Backend == nil && opts.BackendFactory != nil && opts.Synchronous {
+		opts.Backend = newBackendRetrying(opts.BackendFactory)
+	}
+	var queue Queue
 	if !opts.Synchronous {
-		queue = NewBlockingList()
+		if opts.Queue != nil {
+			queue = opts.Queue
+		} else if opts.QueueShards > 1 {
+			queue = NewShardedQueue(opts.QueueShards)
+		} else {
+			queue = NewLockFreeQueue()
+		}
 	}
 
 	hook := &Hook{
-		extra:       opts.Extra,
 		host:        host,
-		level:       logrus.DebugLevel,
-		backend:     opts.Backend,
 		synchronous: opts.Synchronous,
 		queue:       queue,
+		opts:        opts,
+		created:     time.Now(),
+	}
+	if _, ok := queue.(durableQueue); ok {
+		hook.durable = true
+		// 上次运行留下的消息
+		hook.pending.Store(int64(queue.Len()))
+	}
+	hook.extra.Store(&opts.Extra)
+	hook.levelExtra = mergeLevelExtra(opts.LevelExtra)
+	hook.levels = mappedLevels(opts.LevelMapping, opts.CustomLevels)
+	if opts.OutageSummary {
+		hook.outage = &outageTracker{}
+	}
+	hook.SetLevel(logrus.DebugLevel)
+	hook.setSampleRate(1)
+	if opts.Backend != nil {
+		hook.backend.Store(&sharedBackend{Backend: opts.Backend})
+	}
+	if opts.ExitGracePeriod > 0 {
+		logrus.RegisterExitHandler(func() {
+			hook.FlushTimeout(opts.ExitGracePeriod)
+		})
 	}
 	if !opts.Synchronous {
-		for i := 0; i < opts.Concurrency; i++ {
-			go func() {
-				for {
-					entry := hook.queue.FrontBlock()
-					if err := hook.sendEntry(entry.(gelfEntry)); err != nil {
-						fmt.Println(err)
-					}
-				}
-			}()
-		}
+		hook.startWorkers()
+	} else if opts.SendTimeout > 0 {
+		hook.spill = newSpillQueue(opts.SpillQueueSize)
+		go hook.runSpill()
 	}
 	return hook
 }
 
-func (u *Hook) FlushAndClose() error {
-	if !u.synchronous {
-		for {
-			if u.queue.Len() == 0 {
+// NewHookWithBackends creates a hook sending every message to all backends,
+// e.g. graylog and a local file. opts.Backend is ignored.
+func NewHookWithBackends(opts HookOptions, backends ...Backend) *Hook {
+	if len(backends) == 1 {
+		opts.Backend = backends[0]
+	} else {
+		opts.Backend = NewFanoutBackend(backends...)
+	}
+	return NewHook(opts)
+}
+
+// mergeLevelExtra 计算每个级别的字段：该级别及更不严重级别的字段，严重的优先
+func mergeLevelExtra(levelExtra map[logrus.Level]map[string]interface{}) map[logrus.Level]map[string]interface{} {
+	if len(levelExtra) == 0 {
+		return nil
+	}
+	merged := make(map[logrus.Level]map[string]interface{}, len(logrus.AllLevels))
+	for _, level := range logrus.AllLevels {
+		fields := map[string]interface{}{}
+		// from the least severe threshold applying to level to the most severe
+		for threshold := logrus.TraceLevel; ; threshold-- {
+			if threshold >= level {
+				for k, v := range levelExtra[threshold] {
+					fields[k] = v
+				}
+			}
+			if threshold == logrus.PanicLevel {
 				break
 			}
+		}
+		merged[level] = fields
+	}
+	return merged
+}
+
+// newBackendRetrying 创建backend直到成功
+func newBackendRetrying(factory func() (Backend, error)) Backend {
+	for {
+		backend, err := factory()
+		if err != nil {
+			internalLog.Printf("create backend failed: %s\n", err)
 			time.Sleep(1 * time.Second)
+			continue
 		}
+		return backend
 	}
-	return u.backend.Close()
 }
 
-func (u *Hook) Levels() []logrus.Level {
-	var levels []logrus.Level
-	for _, level := range logrus.AllLevels {
-		if level <= u.level {
-			levels = append(levels, level)
+// Flush waits until all queued messages have been sent. It returns immediately
+// for synchronous hooks without SendTimeout.
+func (u *Hook) Flush() {
+	u.drain(0)
+}
+
+// FlushTimeout is like Flush but gives up after timeout, it reports whether
+// all messages were sent
+func (u *Hook) FlushTimeout(timeout time.Duration) bool {
+	return u.drain(timeout)
+}
+
+// drain 等待队列清空，timeout为0时不限时，期间定期调用drainProgress
+func (u *Hook) drain(timeout time.Duration) bool {
+	if u.synchronous && u.spill == nil {
+		return true
+	}
+	start := time.Now()
+	lastProgress := start
+	for {
+		remaining := u.pending.Load()
+		if remaining <= 0 {
+			return true
+		}
+		now := time.Now()
+		if timeout > 0 && now.Sub(start) >= timeout {
+			return false
+		}
+		if u.opts.DrainProgress != nil && now.Sub(lastProgress) >= u.opts.DrainProgressInterval {
+			u.opts.DrainProgress(int(remaining), now.Sub(start))
+			lastProgress = now
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (u *Hook) FlushAndClose() error {
+	u.Flush()
+	if u.spill != nil {
+		u.spill.close()
+	}
+	var err error
+	u.workerBackendsMu.Lock()
+	for _, backend := range u.workerBackends {
+		if cErr := backend.Close(); cErr != nil {
+			err = cErr
 		}
 	}
-	return levels
+	u.workerBackendsMu.Unlock()
+	if backend := u.currentBackend(); backend != nil {
+		if cErr := backend.Close(); cErr != nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// Levels returns all levels: logrus reads them once when the hook is added,
+// Fire filters with the level set by SetLevel, which may change later
+func (u *Hook) Levels() []logrus.Level {
+	return u.levels
 }
 
 func (u *Hook) Fire(entry *logrus.Entry) error {
+	if !u.accept(entry.Level) || u.mutes.mute(entry) {
+		return nil
+	}
 	var file, function string
 	var line int
 
@@ -109,6 +463,19 @@ func (u *Hook) Fire(entry *logrus.Entry) error {
 	for k, v := range entry.Data {
 		newData[k] = v
 	}
+	if _, ok := newData[streamField]; !ok {
+		if stream, ok := StreamFromContext(entry.Context); ok {
+			newData[streamField] = stream
+		} else if u.opts.Stream != "" {
+			newData[streamField] = u.opts.Stream
+		}
+	}
+
+	// honor logrus WithTime, entries built by hand may have no time
+	t := entry.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
 
 	gEntry := gelfEntry{
 		Level:    entry.Level,
@@ -117,21 +484,115 @@ func (u *Hook) Fire(entry *logrus.Entry) error {
 		File:     file,
 		Line:     line,
 		Function: function,
-		Time:     time.Now(),
+		Time:     t,
 	}
 
-	if u.synchronous {
-		if err := u.sendEntry(gEntry); err != nil {
+	if entry.Level <= logrus.FatalLevel {
+		// the process is about to exit or panic, don't let the message wait in the queue
+		return u.sendUrgent(gEntry)
+	}
+
+	if u.spill != nil {
+		m, ok := u.build(gEntry)
+		if !ok {
+			return nil
+		}
+		return u.sendWithinBudget(m)
+	} else if u.synchronous {
+		backend, release := u.acquireBackend()
+		defer release()
+		if err := u.sendEntry(backend, gEntry); err != nil {
 			return err
 		}
+	} else if u.durable {
+		gEntry.Enqueued = time.Now()
+		m, ok := u.build(gEntry)
+		if !ok {
+			return nil
+		}
+		u.pending.Add(1)
+		u.queue.PushBack(queuedMessage{Message: m, Enqueued: gEntry.Enqueued})
 	} else {
+		gEntry.Enqueued = time.Now()
+		u.pending.Add(1)
 		u.queue.PushBack(gEntry)
 	}
 
 	return nil
 }
 
-func (u *Hook) sendEntry(entry gelfEntry) error {
+// ClockOffsetKey additional field holding the offset, in milliseconds, added
+// to the timestamp, see HookOptions.ClockOffset
+const ClockOffsetKey = "_clock_offset_ms"
+
+func (u *Hook) clockOffset() time.Duration {
+	if u.opts.ClockOffsetFunc != nil {
+		return u.opts.ClockOffsetFunc()
+	}
+	return u.opts.ClockOffset
+}
+
+func (u *Hook) sendEntry(backend Backend, entry gelfEntry) error {
+	m, ok := u.build(entry)
+	if !ok {
+		return nil
+	}
+	err := backend.SendMessage(m)
+	u.observeSend(backend, err)
+	return err
+}
+
+// sendUrgent 发送panic/fatal日志：绕过队列，限时发送，失败时写入FallbackWriter
+func (u *Hook) sendUrgent(entry gelfEntry) error {
+	return u.sendUrgentMessage(u.buildMessage(entry))
+}
+
+func (u *Hook) sendUrgentMessage(m *GELFMessage) error {
+	backend, release := u.acquireBackend()
+	if backend == nil {
+		u.workerBackendsMu.Lock()
+		if len(u.workerBackends) > 0 {
+			backend = u.workerBackends[0]
+		}
+		u.workerBackendsMu.Unlock()
+	}
+
+	err := errors.New("no backend available")
+	if backend != nil {
+		done := make(chan error, 1)
+		go func() {
+			defer release()
+			done <- backend.SendMessage(m)
+		}()
+		timer := time.NewTimer(u.opts.FatalTimeout)
+		select {
+		case err = <-done:
+		case <-timer.C:
+			err = fmt.Errorf("send timed out after %s", u.opts.FatalTimeout)
+		}
+		timer.Stop()
+	}
+	if err == nil {
+		return nil
+	}
+
+	data, mErr := json.Marshal(m)
+	if mErr != nil {
+		return err
+	}
+	if _, wErr := u.opts.FallbackWriter.Write(append(data, '\n')); wErr != nil {
+		return err
+	}
+	return nil
+}
+
+func (u *Hook) buildMessage(entry gelfEntry) *GELFMessage {
+	m, _ := u.build(entry)
+	return m
+}
+
+// build 构造消息，ok为false时消息被HookOptions.Schema丢弃
+func (u *Hook) build(entry gelfEntry) (m *GELFMessage, ok bool) {
 	p := bytes.TrimSpace([]byte(entry.Message))
 
 	// 多行则放到full字段，取第一行放到short字段
@@ -142,14 +603,18 @@ func (u *Hook) sendEntry(entry gelfEntry) error {
 		full = p
 	}
 
-	level := logrusLevelToSyslog(entry.Level)
+	level := u.syslogLevel(entry.Level)
 
 	extra := map[string]interface{}{}
-	for k, v := range u.extra {
+	for k, v := range *u.extra.Load() {
 		k = fmt.Sprintf("_%s", k)
 		extra[k] = v
 	}
 
+	for k, v := range u.levelExtra[entry.Level] {
+		extra["_"+k] = v
+	}
+
 	extra["_caller_file"] = entry.File
 	extra["_caller_line"] = entry.Line
 	extra["_caller_function"] = entry.Function
@@ -167,19 +632,58 @@ func (u *Hook) sendEntry(entry gelfEntry) error {
 			if stackTrace := extractStackTrace(asError); stackTrace != nil {
 				extra[StackTraceKey] = fmt.Sprintf("%+v", stackTrace)
 			}
+			if isError && !u.opts.DisableErrorChain {
+				if chain := errorChain(asError); len(chain) > 1 {
+					extra[ErrorChainKey] = chain
+				}
+			}
 		} else {
 			extra[extraK] = v
 		}
 	}
+	var notes *pipelineNotes
+	if u.opts.PipelineNotes {
+		notes = &pipelineNotes{}
+	}
+	u.normalizeFields(extra, notes)
+	u.protectFields(extra, notes)
+	u.coerceFields(extra, notes)
+	urgent := entry.Level <= logrus.FatalLevel
+	violations := u.enforceSchema(extra, urgent, notes)
+
+	t := entry.Time
+	if offset := u.clockOffset(); offset != 0 {
+		t = t.Add(offset)
+		extra[ClockOffsetKey] = float64(offset) / float64(time.Millisecond)
+	}
+
+	if u.opts.StampEnqueuedAt {
+		enqueued := entry.Enqueued
+		if enqueued.IsZero() {
+			enqueued = time.Now()
+		}
+		extra[EnqueuedAtKey] = unixSeconds(enqueued)
+	}
 
-	m := &GELFMessage{
-		Version:  "1.1",
+	m = &GELFMessage{
+		Version:  u.opts.Version,
 		Host:     u.host,
 		Short:    string(short),
 		Full:     string(full),
-		TimeUnix: float64(entry.Time.UnixNano()/1000000) / 1000.,
+		TimeUnix: float64(t.UnixNano()/1000000) / 1000.,
 		Level:    level,
 		Extra:    extra,
 	}
-	return u.backend.SendMessage(m)
+	if u.opts.LegacyFields {
+		m.Facility = u.opts.Facility
+		m.File = entry.File
+		m.Line = entry.Line
+	}
+	if u.opts.StampMessageID {
+		extra[MessageIDKey] = stampMessageID(m, u.opts.MessageIDFields)
+	}
+	u.prefixFields(extra, notes)
+	u.enforceFieldBudget(m, notes)
+	notes.apply(extra)
+	return m, urgent || len(violations) == 0 || u.opts.SchemaAction != SchemaDropMessage
 }
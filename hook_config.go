@@ -0,0 +1,92 @@
+package graylog
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetLevel sets the least severe level sent, default logrus.DebugLevel
+func (u *Hook) SetLevel(level logrus.Level) {
+	u.level.Store(uint32(level))
+}
+
+// Level returns the least severe level sent
+func (u *Hook) Level() logrus.Level {
+	return logrus.Level(u.level.Load())
+}
+
+func (u *Hook) setSampleRate(rate float64) {
+	u.sampleRate.Store(math.Float64bits(rate))
+}
+
+// accept 按级别过滤，info及以下级别按采样率采样
+func (u *Hook) accept(level logrus.Level) bool {
+	level = u.filterLevel(level)
+	if level > u.Level() {
+		return false
+	}
+	if level < logrus.InfoLevel {
+		return true
+	}
+	rate := math.Float64frombits(u.sampleRate.Load())
+	return rate >= 1 || rand.Float64() < rate
+}
+
+// HookConfig settings of a hook that can change at runtime, see ApplyConfig
+// and WatchConfig. Unset fields leave the current setting unchanged.
+type HookConfig struct {
+	// Level least severe level sent, e.g. "info"
+	Level string `json:"level"`
+	// SampleRate fraction of the info, debug and trace entries sent, from 0 to 1.
+	// Warnings and more severe entries are always sent
+	SampleRate *float64 `json:"sample_rate"`
+	// Extra replaces HookOptions.Extra
+	Extra map[string]interface{} `json:"extra"`
+	// Addr address of a new backend replacing the current one with SwapBackend
+	Addr string `json:"addr"`
+}
+
+// ApplyConfig applies the set fields of c. newBackend creates the backend for
+// c.Addr, default NewGelfBackend; it is not called when c.Addr is empty.
+func (u *Hook) ApplyConfig(c HookConfig, newBackend func(addr string) (Backend, error)) error {
+	var level logrus.Level
+	if c.Level != "" {
+		var err error
+		if level, err = logrus.ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	if c.SampleRate != nil && (*c.SampleRate < 0 || *c.SampleRate > 1) {
+		return errors.New("sample rate must be between 0 and 1")
+	}
+	if c.Addr != "" {
+		if !u.synchronous && u.opts.BackendFactory != nil {
+			return errors.New("addr can't be changed, the hook's workers create their own backends with BackendFactory")
+		}
+		if newBackend == nil {
+			newBackend = NewGelfBackend
+		}
+		backend, err := newBackend(c.Addr)
+		if err != nil {
+			return err
+		}
+		if err := u.SwapBackend(backend); err != nil {
+			internalLog.Printf("close replaced backend: %v", err)
+		}
+	}
+
+	if c.Level != "" {
+		u.SetLevel(level)
+	}
+	if c.SampleRate != nil {
+		u.setSampleRate(*c.SampleRate)
+	}
+	if c.Extra != nil {
+		extra := c.Extra
+		u.extra.Store(&extra)
+	}
+	return nil
+}
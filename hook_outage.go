@@ -0,0 +1,118 @@
+package graylog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OutageKey marks the summary message sent when the backend recovers from an
+// outage, see HookOptions.OutageSummary. The summary carries _outage_start,
+// _outage_end, _outage_duration_ms, _outage_dropped, _outage_spooled,
+// _outage_reconnect_attempts and _outage_error
+const OutageKey = "_outage"
+
+// outageTracker 记录发送失败，从第一次失败到下一次成功为一次故障
+type outageTracker struct {
+	// active 有进行中的故障，成功发送时无需加锁
+	active   atomic.Bool
+	mu       sync.Mutex
+	start    time.Time
+	dropped  int64
+	attempts int64
+	lastErr  error
+}
+
+type outage struct {
+	start, end time.Time
+	dropped    int64
+	attempts   int64
+	lastErr    error
+}
+
+func (t *outageTracker) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active.Load() {
+		t.start = time.Now()
+		t.active.Store(true)
+	}
+	t.dropped++
+	// 后端自己重连时使用其重连次数，否则每次失败的发送算一次
+	var reconnectErr *ReconnectError
+	if errors.As(err, &reconnectErr) {
+		t.attempts += int64(reconnectErr.Attempts)
+	} else {
+		t.attempts++
+	}
+	t.lastErr = err
+}
+
+// recover 结束进行中的故障，只有一个调用者得到ok
+func (t *outageTracker) recover() (outage, bool) {
+	if !t.active.Load() {
+		return outage{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.active.Load() {
+		return outage{}, false
+	}
+	o := outage{
+		start:    t.start,
+		end:      time.Now(),
+		dropped:  t.dropped,
+		attempts: t.attempts,
+		lastErr:  t.lastErr,
+	}
+	t.active.Store(false)
+	t.dropped, t.attempts, t.lastErr = 0, 0, nil
+	return o, true
+}
+
+// observeSend records the result of sending a message through backend, and
+// sends the outage summary through it when it recovered
+func (u *Hook) observeSend(backend Backend, err error) {
+	if u.outage == nil {
+		return
+	}
+	if err != nil {
+		u.outage.fail(err)
+		return
+	}
+	o, ok := u.outage.recover()
+	if !ok {
+		return
+	}
+	if err := backend.SendMessage(u.outageMessage(o)); err != nil {
+		internalLog.Printf("send outage summary: %v", err)
+	}
+}
+
+func (u *Hook) outageMessage(o outage) *GELFMessage {
+	// 恢复时仍在排队的消息，不含刚发送成功的这条
+	spooled := u.pending.Load() - 1
+	if spooled < 0 {
+		spooled = 0
+	}
+	duration := o.end.Sub(o.start)
+	m := u.buildMessage(gelfEntry{
+		Level: logrus.WarnLevel,
+		Message: fmt.Sprintf("graylog hook: backend outage of %s ended, %d messages dropped, %d spooled, %d reconnect attempts",
+			duration.Round(time.Millisecond), o.dropped, spooled, o.attempts),
+		Time: o.end,
+	})
+	m.Extra[OutageKey] = true
+	m.Extra["_outage_start"] = o.start.Format(u.opts.TimeFormat)
+	m.Extra["_outage_end"] = o.end.Format(u.opts.TimeFormat)
+	m.Extra["_outage_duration_ms"] = float64(duration) / float64(time.Millisecond)
+	m.Extra["_outage_dropped"] = o.dropped
+	m.Extra["_outage_spooled"] = spooled
+	m.Extra["_outage_reconnect_attempts"] = o.attempts
+	m.Extra["_outage_error"] = o.lastErr.Error()
+	return m
+}
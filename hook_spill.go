@@ -0,0 +1,122 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSpillQueueFull is returned by Fire when a synchronous send exceeded
+// HookOptions.SendTimeout and the spill queue had no room left, the message
+// is dropped
+var ErrSpillQueueFull = errors.New("graylog: spill queue full, message dropped")
+
+// errSpillQueueClosed 在FlushAndClose之后溢出的消息
+var errSpillQueueClosed = errors.New("graylog: hook closed, message dropped")
+
+// spillQueue receives the synchronous sends exceeding HookOptions.SendTimeout
+type spillQueue struct {
+	ch chan spillItem
+	// queued 队列中及正在处理的数量
+	queued atomic.Int64
+	// mu 保护closed，关闭ch时不能有发送者
+	mu     sync.RWMutex
+	closed bool
+	// done runSpill退出时关闭
+	done chan struct{}
+}
+
+type spillItem struct {
+	message *GELFMessage
+	// inflight result of a send that exceeded the budget and goes on in the background
+	inflight <-chan error
+}
+
+func newSpillQueue(size int) *spillQueue {
+	return &spillQueue{ch: make(chan spillItem, size), done: make(chan struct{})}
+}
+
+// close stops accepting messages and waits for runSpill to send the queued ones
+func (s *spillQueue) close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// sendWithinBudget sends m synchronously, giving up waiting after
+// HookOptions.SendTimeout: the send then goes on in the background
+func (u *Hook) sendWithinBudget(m *GELFMessage) error {
+	if u.spill.queued.Load() > 0 {
+		// the backend is slow, don't wait and keep the order
+		return u.pushSpill(spillItem{message: m})
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		backend, release := u.acquireBackend()
+		defer release()
+		err := backend.SendMessage(m)
+		u.observeSend(backend, err)
+		done <- err
+	}()
+	timer := time.NewTimer(u.opts.SendTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return u.pushSpill(spillItem{inflight: done})
+	}
+}
+
+func (u *Hook) pushSpill(item spillItem) error {
+	u.spill.mu.RLock()
+	defer u.spill.mu.RUnlock()
+	if u.spill.closed {
+		if item.inflight != nil {
+			// still being sent, FlushAndClose doesn't wait for it
+			return nil
+		}
+		return errSpillQueueClosed
+	}
+	u.pending.Add(1)
+	u.spill.queued.Add(1)
+	select {
+	case u.spill.ch <- item:
+		return nil
+	default:
+		u.pending.Add(-1)
+		u.spill.queued.Add(-1)
+		if item.inflight != nil {
+			// still being sent, only not waited for by Flush
+			return nil
+		}
+		return ErrSpillQueueFull
+	}
+}
+
+// runSpill 按顺序处理溢出的消息，等待超时的发送结束
+func (u *Hook) runSpill() {
+	defer close(u.spill.done)
+	for item := range u.spill.ch {
+		var err error
+		if item.inflight != nil {
+			err = <-item.inflight
+		} else {
+			backend, release := u.acquireBackend()
+			err = backend.SendMessage(item.message)
+			u.observeSend(backend, err)
+			release()
+		}
+		if err != nil {
+			internalLog.Printf("%v", err)
+		}
+		u.spill.queued.Add(-1)
+		u.pending.Add(-1)
+	}
+}
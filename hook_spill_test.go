@@ -0,0 +1,57 @@
+package graylog
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// slowBackend takes delay for every send
+type slowBackend struct {
+	RecordingBackend
+	delay time.Duration
+}
+
+func (s *slowBackend) SendMessage(m *GELFMessage) error {
+	time.Sleep(s.delay)
+	return s.RecordingBackend.SendMessage(m)
+}
+
+func TestSpillQueueFlushAndClose(t *testing.T) {
+	backend := &slowBackend{delay: 20 * time.Millisecond}
+	hook := NewHook(HookOptions{Backend: backend, Synchronous: true, SendTimeout: time.Millisecond})
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+	for i := 0; i < 5; i++ {
+		logger.Info("spilled")
+	}
+	if err := hook.FlushAndClose(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-hook.spill.done:
+	default:
+		t.Fatal("spill goroutine still running after FlushAndClose")
+	}
+	if n := len(backend.Messages()); n != 5 {
+		t.Fatalf("sent %d messages, want 5", n)
+	}
+
+	// logging after close doesn't panic on the closed channel
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Info("late")
+		}()
+	}
+	wg.Wait()
+	if err := hook.FlushAndClose(); err != nil {
+		t.Fatal(err)
+	}
+}
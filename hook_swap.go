@@ -0,0 +1,62 @@
+package graylog
+
+import (
+	"errors"
+	"sync"
+)
+
+// sharedBackend the backend shared by the hook's senders, replaceable with SwapBackend
+type sharedBackend struct {
+	Backend
+	// mu 发送时持有读锁，SwapBackend持写锁等待发送结束
+	mu      sync.RWMutex
+	retired bool
+}
+
+// currentBackend returns the shared backend without marking it in use
+func (u *Hook) currentBackend() Backend {
+	if s := u.backend.Load(); s != nil {
+		return s.Backend
+	}
+	return nil
+}
+
+// acquireBackend returns the shared backend, nil when there is none, which
+// SwapBackend won't close before release is called
+func (u *Hook) acquireBackend() (backend Backend, release func()) {
+	for {
+		s := u.backend.Load()
+		if s == nil {
+			return nil, func() {}
+		}
+		s.mu.RLock()
+		if !s.retired {
+			return s.Backend, s.mu.RUnlock
+		}
+		// swapped meanwhile, use the new one
+		s.mu.RUnlock()
+	}
+}
+
+// SwapBackend replaces the backend, e.g. to apply a new address or new
+// certificates without recreating the hook. New sends use backend right away;
+// SwapBackend waits for the sends in flight on the previous backend, then
+// closes it and returns the error of Close. A send stuck on the previous
+// backend, e.g. reconnecting forever, keeps SwapBackend waiting.
+func (u *Hook) SwapBackend(backend Backend) error {
+	if backend == nil {
+		return errors.New("swap backend: backend is nil")
+	}
+	if !u.synchronous && u.opts.BackendFactory != nil {
+		return errors.New("swap backend: the hook's workers create their own backends with BackendFactory")
+	}
+
+	old := u.backend.Swap(&sharedBackend{Backend: backend})
+	if old == nil {
+		return nil
+	}
+	old.mu.Lock()
+	old.retired = true
+	old.mu.Unlock()
+	return old.Close()
+}
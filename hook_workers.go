@@ -0,0 +1,157 @@
+package graylog
+
+import (
+	"runtime"
+	"time"
+)
+
+// stopWorker sentinel making one worker exit, pushed by the adaptive supervisor
+type stopWorker struct{}
+
+// adaptInterval how often the adaptive supervisor re-evaluates the worker count
+const adaptInterval = time.Second
+
+// concurrencyHinter is implemented by backends knowing how many concurrent
+// senders they serve efficiently
+type concurrencyHinter interface {
+	concurrencyHint() int
+}
+
+// defaultConcurrency 根据GOMAXPROCS和backend类型决定worker数量
+func defaultConcurrency(opts HookOptions) int {
+	if opts.Backend == nil && opts.BackendFactory != nil {
+		// 每个worker有自己的backend
+		return 2 * runtime.GOMAXPROCS(0)
+	}
+	if hinter, ok := opts.Backend.(concurrencyHinter); ok {
+		return hinter.concurrencyHint()
+	}
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+func (u *Hook) startWorkers() {
+	if !u.opts.AdaptiveConcurrency {
+		for i := 0; i < u.opts.Concurrency; i++ {
+			u.startWorker()
+		}
+		return
+	}
+	for i := 0; i < u.opts.MinConcurrency; i++ {
+		u.startWorker()
+	}
+	go u.adapt()
+}
+
+func (u *Hook) startWorker() {
+	u.workers.Add(1)
+	go u.runWorker()
+}
+
+func (u *Hook) runWorker() {
+	defer u.workers.Add(-1)
+	var backend Backend
+	if u.opts.BackendFactory != nil {
+		backend = newBackendRetrying(u.opts.BackendFactory)
+		u.workerBackendsMu.Lock()
+		u.workerBackends = append(u.workerBackends, backend)
+		u.workerBackendsMu.Unlock()
+		defer u.releaseWorkerBackend(backend)
+	}
+	for {
+		entry := u.queue.FrontBlock()
+		if _, ok := entry.(stopWorker); ok {
+			return
+		}
+		start := time.Now()
+		var err error
+		switch e := entry.(type) {
+		case gelfEntry:
+			u.lastDequeued.Store(e.Enqueued.UnixNano())
+			err = u.sendWorkerEntry(backend, e)
+		case queuedMessage:
+			u.lastDequeued.Store(e.Enqueued.UnixNano())
+			// 无法读取的消息为nil
+			if e.Message != nil {
+				err = u.sendWorkerMessage(backend, e.Message)
+			}
+		}
+		if err != nil {
+			internalLog.Printf("%v", err)
+		}
+		u.sendNanos.Add(int64(time.Since(start)))
+		u.sendCount.Add(1)
+		u.pending.Add(-1)
+	}
+}
+
+// sendWorkerEntry 使用worker自己的backend，没有时使用共享的backend
+func (u *Hook) sendWorkerEntry(backend Backend, entry gelfEntry) error {
+	if backend != nil {
+		return u.sendEntry(backend, entry)
+	}
+	shared, release := u.acquireBackend()
+	defer release()
+	return u.sendEntry(shared, entry)
+}
+
+// sendWorkerMessage 发送durable queue中构造好的消息
+func (u *Hook) sendWorkerMessage(backend Backend, m *GELFMessage) error {
+	if backend == nil {
+		shared, release := u.acquireBackend()
+		defer release()
+		backend = shared
+	}
+	err := backend.SendMessage(m)
+	u.observeSend(backend, err)
+	return err
+}
+
+// releaseWorkerBackend 关闭并移除退出的worker的backend
+func (u *Hook) releaseWorkerBackend(backend Backend) {
+	u.workerBackendsMu.Lock()
+	for i, b := range u.workerBackends {
+		if b == backend {
+			u.workerBackends = append(u.workerBackends[:i], u.workerBackends[i+1:]...)
+			break
+		}
+	}
+	u.workerBackendsMu.Unlock()
+	_ = backend.Close()
+}
+
+// adapt scales workers up while the backlog can't be drained within one
+// interval at the observed send latency, and down by one while the queue is idle
+func (u *Hook) adapt() {
+	ticker := time.NewTicker(adaptInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		workers := int(u.workers.Load())
+		depth := int(u.pending.Load())
+		count := u.sendCount.Swap(0)
+		nanos := u.sendNanos.Swap(0)
+
+		var latency time.Duration
+		if count > 0 {
+			latency = time.Duration(nanos / count)
+		}
+
+		switch {
+		case depth > 0 && workers < u.opts.MaxConcurrency:
+			if latency > 0 && time.Duration(depth)*latency/time.Duration(workers) <= adaptInterval {
+				continue
+			}
+			add := workers / 2
+			if add < 1 {
+				add = 1
+			}
+			if workers+add > u.opts.MaxConcurrency {
+				add = u.opts.MaxConcurrency - workers
+			}
+			for i := 0; i < add; i++ {
+				u.startWorker()
+			}
+		case depth == 0 && workers > u.opts.MinConcurrency:
+			u.queue.PushBack(stopWorker{})
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package graylog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// internalLogger prints the package's own errors. Identical messages are
+// printed at most once per interval, the number of suppressed repetitions is
+// appended to the next one printed.
+type internalLogger struct {
+	mu       sync.Mutex
+	out      io.Writer
+	interval time.Duration
+	seen     map[string]*loggedMessage
+	// recent ring of the last printed messages, for Hook.Snapshot
+	recent     [recentInternalErrors]InternalError
+	recentNext int
+}
+
+// InternalError an error the package reported about itself
+type InternalError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// recentInternalErrors number of internal errors kept for Hook.Snapshot
+const recentInternalErrors = 20
+
+type loggedMessage struct {
+	last       time.Time
+	suppressed int
+}
+
+// maxTrackedMessages bounds the memory used to remember printed messages
+const maxTrackedMessages = 1024
+
+var internalLog = newInternalLogger(os.Stdout, 10*time.Second)
+
+func newInternalLogger(out io.Writer, interval time.Duration) *internalLogger {
+	return &internalLogger{
+		out:      out,
+		interval: interval,
+		seen:     make(map[string]*loggedMessage),
+	}
+}
+
+// SetInternalLogger configures where the package reports its own errors (send
+// failures, reconnects, ...) and how often an identical error may be repeated.
+// default os.Stdout and 10s, an interval <= 0 disables rate limiting.
+func SetInternalLogger(out io.Writer, interval time.Duration) {
+	internalLog.mu.Lock()
+	defer internalLog.mu.Unlock()
+	internalLog.out = out
+	internalLog.interval = interval
+}
+
+func (l *internalLogger) Printf(format string, args ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	line := msg
+	if m, ok := l.seen[msg]; ok {
+		if l.interval > 0 && now.Sub(m.last) < l.interval {
+			m.suppressed += 1
+			return
+		}
+		if m.suppressed > 0 {
+			line = fmt.Sprintf("%s (%d identical messages suppressed)", msg, m.suppressed)
+		}
+	}
+	_, _ = fmt.Fprintln(l.out, line)
+	l.remember(msg, now)
+	l.recent[l.recentNext%recentInternalErrors] = InternalError{Time: now, Message: line}
+	l.recentNext++
+}
+
+// recentErrors returns the last printed messages, oldest first
+func (l *internalLogger) recentErrors() []InternalError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.recentNext
+	if n > recentInternalErrors {
+		n = recentInternalErrors
+	}
+	errs := make([]InternalError, 0, n)
+	for i := l.recentNext - n; i < l.recentNext; i++ {
+		errs = append(errs, l.recent[i%recentInternalErrors])
+	}
+	return errs
+}
+
+func (l *internalLogger) remember(msg string, now time.Time) {
+	if len(l.seen) >= maxTrackedMessages {
+		for k, m := range l.seen {
+			if now.Sub(m.last) >= l.interval {
+				delete(l.seen, k)
+			}
+		}
+		if len(l.seen) >= maxTrackedMessages {
+			return
+		}
+	}
+	l.seen[msg] = &loggedMessage{last: now}
+}
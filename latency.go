@@ -0,0 +1,42 @@
+package graylog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// EnqueuedAtKey additional field holding the unix time, in seconds, at which
+// the hook queued the message, see HookOptions.StampEnqueuedAt
+const EnqueuedAtKey = "_enqueued_at"
+
+// TransportLatencyKey additional field holding the milliseconds between
+// EnqueuedAtKey and the message being forwarded, see BridgeOptions.TransportLatency
+const TransportLatencyKey = "_transport_latency_ms"
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()/1000000) / 1000.
+}
+
+// withTransportLatency returns a copy of m with TransportLatencyKey computed
+// from EnqueuedAtKey, m when it has no EnqueuedAtKey
+func withTransportLatency(m *GELFMessage, now time.Time) *GELFMessage {
+	v, ok := m.Extra[EnqueuedAtKey]
+	if !ok {
+		return m
+	}
+	// float64 or json.Number after a json round-trip
+	enqueued, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+	if err != nil {
+		return m
+	}
+	c := *m
+	c.Extra = make(map[string]interface{}, len(m.Extra)+1)
+	for k, v := range m.Extra {
+		c.Extra[k] = v
+	}
+	// both times have a millisecond resolution
+	c.Extra[TransportLatencyKey] = math.Round((unixSeconds(now) - enqueued) * 1000)
+	return &c
+}
@@ -0,0 +1,57 @@
+package graylog
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// syslogLevel syslog level sent for a logrus level, see HookOptions.LevelMapping
+func (u *Hook) syslogLevel(level logrus.Level) int32 {
+	if l, ok := u.opts.LevelMapping[level]; ok {
+		return l
+	}
+	if level > logrus.TraceLevel {
+		return u.opts.FallbackLevel
+	}
+	return logrusLevelToSyslog(level)
+}
+
+// filterLevel logrus level a custom level is filtered and sampled as: the
+// closest to the syslog level it is sent with
+func (u *Hook) filterLevel(level logrus.Level) logrus.Level {
+	if level <= logrus.TraceLevel {
+		return level
+	}
+	switch l := u.syslogLevel(level); {
+	case l <= LogAlert:
+		return logrus.PanicLevel
+	case l == LogCrit:
+		return logrus.FatalLevel
+	case l == LogErr:
+		return logrus.ErrorLevel
+	case l == LogWarning:
+		return logrus.WarnLevel
+	case l == LogNotice, l == LogInfo:
+		return logrus.InfoLevel
+	default:
+		return logrus.DebugLevel
+	}
+}
+
+// mappedLevels logrus levels plus the custom levels of LevelMapping and CustomLevels
+func mappedLevels(mapping map[logrus.Level]int32, custom []logrus.Level) []logrus.Level {
+	levels := append([]logrus.Level(nil), logrus.AllLevels...)
+	seen := make(map[logrus.Level]bool)
+	for level := range mapping {
+		if level > logrus.TraceLevel && !seen[level] {
+			seen[level] = true
+			levels = append(levels, level)
+		}
+	}
+	for _, level := range custom {
+		if level > logrus.TraceLevel && !seen[level] {
+			seen[level] = true
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
@@ -0,0 +1,32 @@
+package graylog
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestCustomLevelsFallback(t *testing.T) {
+	const auditLevel = logrus.Level(8)
+	recording := NewRecordingBackend()
+	hook := NewHook(HookOptions{
+		Backend:       recording,
+		Synchronous:   true,
+		FallbackLevel: LogNotice,
+		CustomLevels:  []logrus.Level{auditLevel},
+	})
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.SetLevel(auditLevel)
+	logger.AddHook(hook)
+	logger.Log(auditLevel, "audit")
+
+	m := recording.LastMessage()
+	if m == nil {
+		t.Fatal("custom level not fired to the hook")
+	}
+	if m.Level != LogNotice {
+		t.Errorf("sent level %d, want FallbackLevel %d", m.Level, LogNotice)
+	}
+}
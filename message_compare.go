@@ -0,0 +1,135 @@
+package graylog
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldDiff is a field whose value differs between two messages. Field is the
+// wire name, e.g. short_message or _request_id. A missing field is nil.
+type FieldDiff struct {
+	Field string
+	A     interface{}
+	B     interface{}
+}
+
+type compareConfig struct {
+	ignored map[string]bool
+}
+
+// CompareOption adjusts DiffMessages and EqualMessages
+type CompareOption func(c *compareConfig)
+
+// IgnoreTimestamp excludes the timestamp, e.g. to compare a message with its retried copy
+func IgnoreTimestamp() CompareOption {
+	return IgnoreFields("timestamp")
+}
+
+// IgnoreFields excludes fields given by wire name, e.g. "host" or "_caller_line"
+func IgnoreFields(fields ...string) CompareOption {
+	return func(c *compareConfig) {
+		for _, f := range fields {
+			c.ignored[f] = true
+		}
+	}
+}
+
+// messageFields flattens a message into wire name -> value
+func messageFields(m *GELFMessage) map[string]interface{} {
+	fields := map[string]interface{}{
+		"version":       m.Version,
+		"host":          m.Host,
+		"short_message": m.Short,
+		"full_message":  m.Full,
+		"timestamp":     m.TimeUnix,
+		"level":         m.Level,
+		"facility":      m.Facility,
+		"line":          m.Line,
+		"file":          m.File,
+	}
+	for k, v := range m.Extra {
+		fields[k] = v
+	}
+	return fields
+}
+
+// valuesEqual compares loosely so that values survive a json round-trip, e.g.
+// int 3 equals json.Number("3") and float64 3
+func valuesEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b) || fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// DiffMessages returns the fields whose values differ, sorted by field name
+func DiffMessages(a, b *GELFMessage, opts ...CompareOption) []FieldDiff {
+	c := &compareConfig{ignored: map[string]bool{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	fa, fb := messageFields(a), messageFields(b)
+	var diffs []FieldDiff
+	for k, va := range fa {
+		if c.ignored[k] {
+			continue
+		}
+		if vb, ok := fb[k]; !ok || !valuesEqual(va, vb) {
+			diffs = append(diffs, FieldDiff{Field: k, A: va, B: vb})
+		}
+	}
+	for k, vb := range fb {
+		if _, ok := fa[k]; !ok && !c.ignored[k] {
+			diffs = append(diffs, FieldDiff{Field: k, B: vb})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
+
+// EqualMessages reports whether two messages have the same fields and values
+func EqualMessages(a, b *GELFMessage, opts ...CompareOption) bool {
+	return len(DiffMessages(a, b, opts...)) == 0
+}
+
+// MergeMessages returns a copy of dst overlaid with the non-empty standard
+// fields and all additional fields of src
+func MergeMessages(dst, src *GELFMessage) *GELFMessage {
+	merged := *dst
+	merged.Extra = make(map[string]interface{}, len(dst.Extra)+len(src.Extra))
+	for k, v := range dst.Extra {
+		merged.Extra[k] = v
+	}
+	for k, v := range src.Extra {
+		merged.Extra[k] = v
+	}
+	if src.Version != "" {
+		merged.Version = src.Version
+	}
+	if src.Host != "" {
+		merged.Host = src.Host
+	}
+	if src.Short != "" {
+		merged.Short = src.Short
+	}
+	if src.Full != "" {
+		merged.Full = src.Full
+	}
+	if src.TimeUnix != 0 {
+		merged.TimeUnix = src.TimeUnix
+	}
+	if src.Level != 0 {
+		merged.Level = src.Level
+	}
+	if src.Facility != "" {
+		merged.Facility = src.Facility
+	}
+	if src.Line != 0 {
+		merged.Line = src.Line
+	}
+	if src.File != "" {
+		merged.File = src.File
+	}
+	return &merged
+}
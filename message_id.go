@@ -0,0 +1,70 @@
+package graylog
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MessageIDKey additional field carrying the message id, see HookOptions.StampMessageID
+const MessageIDKey = "_message_id"
+
+var (
+	// processNonce 每个进程不同，区分不同进程中相同的消息
+	processNonce = newProcessNonce()
+	// messageSeq 区分同一进程中相同的消息
+	messageSeq atomic.Uint64
+)
+
+func newProcessNonce() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// MessageID computes a deterministic id from the host, timestamp, message and
+// the given additional fields (by name as logged). Identical messages get the
+// same id, the hook stamps stampMessageID instead
+func MessageID(m *GELFMessage, fields ...string) string {
+	return messageID(m, fields)
+}
+
+// stampMessageID id unique to each built message: the copies of a message
+// retried over several transports share it, identical messages logged twice
+// don't
+func stampMessageID(m *GELFMessage, fields []string) string {
+	return messageID(m, fields, processNonce, strconv.FormatUint(messageSeq.Add(1), 10))
+}
+
+func messageID(m *GELFMessage, fields []string, salt ...string) string {
+	h := sha256.New()
+	write := func(s string) {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	write(m.Host)
+	write(strconv.FormatFloat(m.TimeUnix, 'f', -1, 64))
+	write(m.Short)
+	write(m.Full)
+
+	sorted := append([]string(nil), fields...)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if v, ok := extraField(m, name); ok {
+			write(name)
+			write(fmt.Sprint(v))
+		}
+	}
+	for _, s := range salt {
+		write(s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
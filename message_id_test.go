@@ -0,0 +1,27 @@
+package graylog
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestStampMessageID(t *testing.T) {
+	logger, recording := recordingLogger()
+	logger.ReplaceHooks(logrus.LevelHooks{})
+	logger.AddHook(NewHook(HookOptions{Backend: recording, Synchronous: true, StampMessageID: true}))
+	for i := 0; i < 2; i++ {
+		logger.WithField("attempt", 1).Info("retrying")
+	}
+	messages := recording.Messages()
+	first, second := messages[0].Extra[MessageIDKey], messages[1].Extra[MessageIDKey]
+	if first == nil || first == second {
+		t.Fatalf("identical messages got ids %v and %v", first, second)
+	}
+
+	// the deterministic id only depends on the content
+	m := &GELFMessage{Host: "h", Short: "s", TimeUnix: 1}
+	if MessageID(m) != MessageID(&GELFMessage{Host: "h", Short: "s", TimeUnix: 1}) {
+		t.Error("MessageID differs for identical messages")
+	}
+}
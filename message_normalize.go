@@ -0,0 +1,89 @@
+package graylog
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnknownHost host of received messages that had none, see NormalizeMessage
+const UnknownHost = "unknown"
+
+// NormalizeMessage fixes, in place, what a received message violates of the
+// GELF spec, so relays never forward it as is: a missing version, host or
+// timestamp is filled in and the level is clamped to the syslog levels 0 to 7.
+// Additional field names are sanitized: characters other than letters,
+// digits, _, . and - are replaced by _, the leading _ is added when missing,
+// the reserved _id is renamed _id_ and an empty name _empty. It reports
+// whether m was changed. The LaunchConsume implementations and GelfServer
+// normalize every message before calling their callback.
+func NormalizeMessage(m *GELFMessage) bool {
+	if m == nil {
+		return false
+	}
+	changed := false
+	if m.Version == "" {
+		m.Version = GELFVersion11
+		changed = true
+	}
+	if strings.TrimSpace(m.Host) == "" {
+		m.Host = UnknownHost
+		changed = true
+	}
+	if m.TimeUnix <= 0 {
+		m.TimeUnix = unixSeconds(time.Now())
+		changed = true
+	}
+	if m.Level < LogEmerg {
+		m.Level = LogEmerg
+		changed = true
+	} else if m.Level > LogDebug {
+		m.Level = LogDebug
+		changed = true
+	}
+
+	var renamed []string
+	for k := range m.Extra {
+		if sanitizeFieldName(k) != k {
+			renamed = append(renamed, k)
+		}
+	}
+	// sorted so that colliding names are resolved the same way every time
+	sort.Strings(renamed)
+	for _, k := range renamed {
+		name := sanitizeFieldName(k)
+		// 不覆盖已有字段
+		for {
+			if _, ok := m.Extra[name]; !ok {
+				break
+			}
+			name += "_"
+		}
+		m.Extra[name] = m.Extra[k]
+		delete(m.Extra, k)
+		changed = true
+	}
+	return changed
+}
+
+// sanitizeFieldName valid GELF additional field name for k
+func sanitizeFieldName(k string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, k)
+	if !strings.HasPrefix(name, "_") {
+		name = "_" + name
+	}
+	switch name {
+	case "_id":
+		// reserved by graylog
+		return "_id_"
+	case "_":
+		return "_empty"
+	}
+	return name
+}
@@ -0,0 +1,182 @@
+package graylog
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type HTTPMiddlewareOptions struct {
+	// Logger receives one entry per request, with the hook attached.
+	// default logrus.StandardLogger()
+	Logger logrus.FieldLogger
+	// Skip requests not to log, e.g. health checks
+	Skip func(r *http.Request) bool
+	// TrustProxy take _remote_ip from the X-Forwarded-For or X-Real-IP headers,
+	// only enable it behind a proxy setting them. default false
+	TrustProxy bool
+}
+
+// NewHTTPMiddleware returns a net/http middleware logging a summary of every
+// request with the fields _method, _path, _status, _duration_ms, _remote_ip and
+// _bytes. 5xx responses are logged as errors, 4xx as warnings, others as info.
+// Frameworks with their own middleware type use HTTPRequestLogger instead.
+func NewHTTPMiddleware(opts HTTPMiddlewareOptions) func(http.Handler) http.Handler {
+	logger := NewHTTPRequestLogger(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if logger.skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rw := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+			logger.Log(r, rw.status, rw.bytes, start)
+		})
+	}
+}
+
+// HTTPRequestLogger logs the request summaries of NewHTTPMiddleware for
+// frameworks with their own middleware type, without depending on them.
+// With gin:
+//
+//	requests := graylog.NewHTTPRequestLogger(opts)
+//	router.Use(func(c *gin.Context) {
+//		start := time.Now()
+//		c.Next()
+//		requests.Log(c.Request, c.Writer.Status(), c.Writer.Size(), start)
+//	})
+//
+// With echo, where the error handler writes the response of a failed handler:
+//
+//	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+//		return func(c echo.Context) error {
+//			start := time.Now()
+//			if err := next(c); err != nil {
+//				c.Error(err)
+//			}
+//			requests.Log(c.Request(), c.Response().Status, int(c.Response().Size), start)
+//			return nil
+//		}
+//	})
+type HTTPRequestLogger struct {
+	opts HTTPMiddlewareOptions
+}
+
+func NewHTTPRequestLogger(opts HTTPMiddlewareOptions) *HTTPRequestLogger {
+	if opts.Logger == nil {
+		opts.Logger = logrus.StandardLogger()
+	}
+	return &HTTPRequestLogger{opts: opts}
+}
+
+func (l *HTTPRequestLogger) skip(r *http.Request) bool {
+	return l.opts.Skip != nil && l.opts.Skip(r)
+}
+
+// Log logs the summary of a request that started at start, unless
+// HTTPMiddlewareOptions.Skip skips it. A status of 0 is logged as 200, a
+// negative bytes as 0.
+func (l *HTTPRequestLogger) Log(r *http.Request, status, bytes int, start time.Time) {
+	if l.skip(r) {
+		return
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if bytes < 0 {
+		// gin reports -1 before the body is written
+		bytes = 0
+	}
+	entry := l.opts.Logger.WithFields(logrus.Fields{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"status":      status,
+		"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		"remote_ip":   remoteIP(r, l.opts.TrustProxy),
+		"bytes":       bytes,
+	})
+	msg := fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status)
+	switch {
+	case status >= 500:
+		entry.Error(msg)
+	case status >= 400:
+		entry.Warn(msg)
+	default:
+		entry.Info(msg)
+	}
+}
+
+// statusRecorder 记录响应状态码和字节数
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Flush forwards to the wrapped writer, for streaming handlers asserting http.Flusher
+func (w *statusRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the wrapped writer, for websocket upgrades asserting http.Hijacker
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T can't be hijacked: %w", w.ResponseWriter, http.ErrNotSupported)
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach Flush, Hijack etc. of the wrapped writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func remoteIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			ip, _, _ := strings.Cut(xff, ",")
+			return strings.TrimSpace(ip)
+		}
+		if ip := r.Header.Get("X-Real-IP"); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,96 @@
+package graylog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func recordingLogger() (*logrus.Logger, *RecordingBackend) {
+	recording := NewRecordingBackend()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(NewHook(HookOptions{Backend: recording, Synchronous: true}))
+	return logger, recording
+}
+
+func TestHTTPMiddlewareFlushHijack(t *testing.T) {
+	logger, recording := recordingLogger()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Error("http.Flusher not forwarded")
+			return
+		}
+		io.WriteString(w, "chunk")
+		f.Flush()
+	})
+	mux.HandleFunc("/upgrade", func(w http.ResponseWriter, r *http.Request) {
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("http.Hijacker not forwarded")
+			return
+		}
+		conn, buf, err := h.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		buf.Flush()
+	})
+	server := httptest.NewServer(NewHTTPMiddleware(HTTPMiddlewareOptions{Logger: logger})(mux))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /upgrade HTTP/1.1\r\nHost: x\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("upgrade answered %d", resp.StatusCode)
+	}
+
+	waitFor(t, time.Second, func() bool { return len(recording.Messages()) == 2 })
+	for i, want := range []int{http.StatusOK, http.StatusSwitchingProtocols} {
+		if got := recording.Messages()[i].Extra["_status"]; got != want {
+			t.Errorf("request %d logged status %v, want %d", i, got, want)
+		}
+	}
+}
+
+func TestHTTPRequestLogger(t *testing.T) {
+	logger, recording := recordingLogger()
+	requests := NewHTTPRequestLogger(HTTPMiddlewareOptions{Logger: logger})
+	r := httptest.NewRequest(http.MethodGet, "/x", nil)
+	// as reported by gin before anything is written
+	requests.Log(r, 0, -1, time.Now())
+	m := recording.LastMessage()
+	if m == nil || m.Extra["_status"] != http.StatusOK || m.Extra["_bytes"] != 0 {
+		t.Fatalf("logged %+v", m)
+	}
+	requests.Log(r, http.StatusBadGateway, 10, time.Now())
+	if m := recording.LastMessage(); m.Level != LogErr {
+		t.Errorf("5xx logged at level %d", m.Level)
+	}
+}
@@ -0,0 +1,158 @@
+package graylog
+
+import (
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MuteRule drops the entries matching a predicate, see Hook.Mute
+type MuteRule struct {
+	hook  *Hook
+	name  string
+	match func(entry *logrus.Entry) bool
+	// until 过期时间(unix纳秒)，0表示不过期
+	until atomic.Int64
+	muted atomic.Uint64
+}
+
+// MuteRuleState describes a mute rule in HookSnapshot
+type MuteRuleState struct {
+	Name string `json:"name"`
+	// Until when the rule expires, nil when it lasts until Unmute
+	Until *time.Time `json:"until,omitempty"`
+	Muted uint64     `json:"muted"`
+}
+
+// muteRules 写时复制，Fire只读取
+type muteRules struct {
+	mu    sync.Mutex
+	rules atomic.Pointer[[]*MuteRule]
+	// muted entries dropped by every rule, removed ones included
+	muted atomic.Uint64
+}
+
+// MessageMatching returns a Mute predicate matching the entries whose message
+// matches re
+func MessageMatching(re *regexp.Regexp) func(entry *logrus.Entry) bool {
+	return func(entry *logrus.Entry) bool {
+		return re.MatchString(entry.Message)
+	}
+}
+
+// Mute drops the entries for which match returns true during d, e.g. a known
+// noisy message during an incident, or until Unmute when d is 0. Panic and
+// fatal entries are never muted. A rule with the same name is replaced. The
+// dropped entries are counted in Snapshot.
+func (u *Hook) Mute(name string, match func(entry *logrus.Entry) bool, d time.Duration) *MuteRule {
+	rule := &MuteRule{hook: u, name: name, match: match}
+	rule.Renew(d)
+
+	u.mutes.mu.Lock()
+	defer u.mutes.mu.Unlock()
+	now := time.Now()
+	rules := []*MuteRule{rule}
+	for _, r := range u.mutes.load() {
+		if r.name != name && !r.expired(now) {
+			rules = append(rules, r)
+		}
+	}
+	u.mutes.rules.Store(&rules)
+	return rule
+}
+
+// Unmute removes the rule with this name, it reports whether one existed
+func (u *Hook) Unmute(name string) bool {
+	return u.mutes.remove(func(r *MuteRule) bool { return r.name == name })
+}
+
+// remove 删除匹配的规则，返回是否有删除
+func (m *muteRules) remove(match func(r *MuteRule) bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rules []*MuteRule
+	found := false
+	for _, r := range m.load() {
+		if match(r) {
+			found = true
+		} else {
+			rules = append(rules, r)
+		}
+	}
+	m.rules.Store(&rules)
+	return found
+}
+
+func (m *muteRules) load() []*MuteRule {
+	if rules := m.rules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// mute reports whether an active rule matches the entry
+func (m *muteRules) mute(entry *logrus.Entry) bool {
+	rules := m.load()
+	if len(rules) == 0 || entry.Level <= logrus.FatalLevel {
+		return false
+	}
+	now := time.Now()
+	for _, r := range rules {
+		if !r.expired(now) && r.match(entry) {
+			r.muted.Add(1)
+			m.muted.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+// states 未过期的规则
+func (m *muteRules) states() []MuteRuleState {
+	now := time.Now()
+	var states []MuteRuleState
+	for _, r := range m.load() {
+		if r.expired(now) {
+			continue
+		}
+		state := MuteRuleState{Name: r.name, Muted: r.Muted()}
+		if until := r.until.Load(); until > 0 {
+			t := time.Unix(0, until)
+			state.Until = &t
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// Name returns the name the rule was created with
+func (r *MuteRule) Name() string {
+	return r.name
+}
+
+// Muted returns the number of entries dropped by the rule
+func (r *MuteRule) Muted() uint64 {
+	return r.muted.Load()
+}
+
+// Renew makes the rule last d from now, or until Unmute when d is 0
+func (r *MuteRule) Renew(d time.Duration) {
+	var until int64
+	if d > 0 {
+		until = time.Now().Add(d).UnixNano()
+	}
+	r.until.Store(until)
+}
+
+// Unmute removes the rule from its hook
+func (r *MuteRule) Unmute() {
+	r.hook.mutes.remove(func(other *MuteRule) bool { return other == r })
+}
+
+func (r *MuteRule) expired(now time.Time) bool {
+	until := r.until.Load()
+	return until > 0 && now.UnixNano() >= until
+}
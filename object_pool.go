@@ -1,7 +1,6 @@
 package graylog
 
 import (
-	"fmt"
 	"sync"
 	"time"
 )
@@ -33,7 +32,7 @@ func (p *ObjectPool) Get() interface{} {
 		for {
 			obj, err := p.factory()
 			if err != nil {
-				fmt.Printf("create obj failed: %s\n", err)
+				internalLog.Printf("create obj failed: %s\n", err)
 				time.Sleep(1 * time.Second)
 				continue
 			}
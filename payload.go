@@ -0,0 +1,108 @@
+package graylog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/viruscoding/logrus-graylog-hook/gelf"
+)
+
+// ErrChunkedPayload is returned by DecodePayload for a single GELF chunk, which
+// must first be reassembled with a ChunkAssembler
+var ErrChunkedPayload = gelf.ErrChunked
+
+// NoCompressKey additional field forcing a message to be sent uncompressed,
+// e.g. WithField("gelf_no_compress", true) to read it in a packet capture.
+// The field itself is not sent.
+const NoCompressKey = "_gelf_no_compress"
+
+// takeNoCompress reports whether the message asks to be sent uncompressed and
+// returns it without the NoCompressKey field, the original is not modified
+func takeNoCompress(m *GELFMessage) (*GELFMessage, bool) {
+	v, ok := m.Extra[NoCompressKey]
+	if !ok {
+		return m, false
+	}
+	c := *m
+	c.Extra = make(map[string]interface{}, len(m.Extra))
+	for k, v := range m.Extra {
+		if k != NoCompressKey {
+			c.Extra[k] = v
+		}
+	}
+	return &c, isTruthy(v)
+}
+
+// isTruthy true for true, "true", "1" and non-zero numbers
+func isTruthy(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		t, _ := strconv.ParseBool(b)
+		return t
+	}
+	n, ok := coerceValue(v, FieldTypeNumber)
+	return ok && fmt.Sprint(n) != "0"
+}
+
+// CompressionType compression of payloads. The GELF spec allows gzip and zlib,
+// zstd and snappy are only understood by this package, e.g. for redis tasks
+type CompressionType = gelf.Compression
+
+const (
+	// CompressionGzip default
+	CompressionGzip = gelf.Gzip
+	// CompressionZlib for receivers only accepting zlib
+	CompressionZlib = gelf.Zlib
+	// CompressionNone raw JSON datagrams, chunked when needed. Saves CPU on
+	// fast networks, e.g. within a datacenter
+	CompressionNone = gelf.Uncompressed
+	// CompressionZstd much cheaper than gzip for a similar ratio
+	CompressionZstd = gelf.Zstd
+	// CompressionSnappy cheapest, with a lower ratio. Uses the snappy framing
+	// format, which starts with a stream identifier
+	CompressionSnappy = gelf.Snappy
+)
+
+// checkCompressionLevel rejects levels gzip and zlib don't accept
+func checkCompressionLevel(level int) error {
+	return gelf.CheckLevel(gelf.Gzip, level)
+}
+
+// compressionLevelOr 级别非法时记录到internalLog并返回默认级别，
+// 用于不返回错误的构造函数
+func compressionLevelOr(backend string, t CompressionType, level, fallback int) int {
+	if err := gelf.CheckLevel(t, level); err != nil {
+		internalLog.Printf("%s backend: %v, using %d", backend, err, fallback)
+		return fallback
+	}
+	return level
+}
+
+// compressPayload 按压缩类型压缩，zstd的level为zstd级别
+func compressPayload(data []byte, t CompressionType, level int) ([]byte, error) {
+	return gelf.Compress(data, t, level)
+}
+
+// encodeGzipPayload 序列化并gzip压缩消息(或消息列表)
+func encodeGzipPayload(v interface{}, level int) ([]byte, error) {
+	return encodePayload(v, CompressionGzip, level)
+}
+
+// encodePayload 序列化并压缩消息(或消息列表)
+func encodePayload(v interface{}, t CompressionType, level int) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return compressPayload(data, t, level)
+}
+
+// DecodePayload detects the encoding of a received GELF payload from its magic
+// bytes and returns the plain JSON: gzip, zlib, zstd, snappy (framed) and
+// uncompressed JSON are accepted.
+func DecodePayload(b []byte) ([]byte, error) {
+	return gelf.Decode(b)
+}
@@ -0,0 +1,29 @@
+package graylog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PipelineNotesKey additional field listing what the hook changed in a
+// message, see HookOptions.PipelineNotes
+const PipelineNotesKey = "_pipeline_notes"
+
+// pipelineNotes collects the changes made by buildMessage, nil when
+// HookOptions.PipelineNotes is disabled
+type pipelineNotes []string
+
+func (n *pipelineNotes) add(format string, args ...interface{}) {
+	if n == nil {
+		return
+	}
+	*n = append(*n, fmt.Sprintf(format, args...))
+}
+
+// apply 记录到消息中
+func (n *pipelineNotes) apply(extra map[string]interface{}) {
+	if n == nil || len(*n) == 0 {
+		return
+	}
+	extra[PipelineNotesKey] = strings.Join(*n, "; ")
+}
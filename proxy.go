@@ -0,0 +1,173 @@
+package graylog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dial lets a dialFunc reach the proxy for proxy.SOCKS5
+func (f dialFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+func (f dialFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// parseProxyURL accepts socks5://, socks5h://, http:// and https:// proxies
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http", "https":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: expected socks5://, http:// or https://", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// proxyFromEnvironment the proxy for tcp connections to addr: ALL_PROXY, or
+// HTTPS_PROXY when unset, nil when NO_PROXY excludes addr or none is set
+func proxyFromEnvironment(addr string) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	for _, key := range []string{"ALL_PROXY", "all_proxy"} {
+		if v := os.Getenv(key); v != "" {
+			cfg.HTTPSProxy = v
+			break
+		}
+	}
+	return cfg.ProxyFunc()(&url.URL{Scheme: "https", Host: addr})
+}
+
+// proxyDialer returns a dial function connecting to addresses through the
+// proxy, which is reached with forward
+func proxyDialer(proxyURL *url.URL, forward dialFunc) (dialFunc, error) {
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, forward)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.(proxy.ContextDialer).DialContext, nil
+	case "http", "https":
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialHTTPConnect(ctx, proxyURL, forward, addr)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+}
+
+// dialHTTPConnect 通过http代理的CONNECT方法建立隧道
+func dialHTTPConnect(ctx context.Context, proxyURL *url.URL, forward dialFunc, addr string) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+	conn, err := forward(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy %s refused CONNECT %s: %s", proxyURL.Host, addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// the peer spoke first, keep what was read along with the response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the CONNECT response first
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// useProxy 根据Proxy或环境变量替换tcp连接的拨号函数
+func (u *gelfBackend) useProxy(opts GelfOptions) error {
+	var proxyURL *url.URL
+	var err error
+	switch {
+	case opts.Proxy != "":
+		if !u.networkType.isTCP() {
+			return fmt.Errorf("a proxy can't be used for %s addresses", u.networkType)
+		}
+		proxyURL, err = parseProxyURL(opts.Proxy)
+	case opts.ProxyFromEnvironment && u.networkType.isTCP():
+		if proxyURL, err = proxyFromEnvironment(u.addr); err == nil && proxyURL != nil {
+			_, err = parseProxyURL(proxyURL.String())
+		}
+	}
+	if err != nil || proxyURL == nil {
+		return err
+	}
+	u.dialContext, err = proxyDialer(proxyURL, u.dialContext)
+	return err
+}
@@ -2,9 +2,50 @@ package graylog
 
 import (
 	"container/list"
+	"encoding/json"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Queue is the queue between Hook.Fire and the async workers, see
+// HookOptions.Queue. Values are opaque to the queue and may hold arbitrary
+// field values, so custom implementations keep them in memory. NewDiskQueue
+// and NewRedisQueue store the messages outside the process instead.
+// Implementations must be safe for concurrent use by several producers and
+// consumers.
+type Queue interface {
+	PushBack(v interface{})
+	// FrontBlock removes and returns the front value, waiting for one
+	FrontBlock() interface{}
+	Len() int
+}
+
+// durableQueue a queue storing the messages outside the process. Field
+// values may not survive serialization, so the hook builds the messages
+// before queueing them as queuedMessage values
+type durableQueue interface {
+	Queue
+	durable()
+}
+
+// queuedMessage message built by the hook, as stored by a durable queue
+type queuedMessage struct {
+	Message  *GELFMessage `json:"message"`
+	Enqueued time.Time    `json:"enqueued"`
+}
+
+// decodeQueuedMessage 解码失败时返回空消息，worker跳过它
+func decodeQueuedMessage(data []byte) queuedMessage {
+	var m queuedMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		internalLog.Printf("decode queued message: %v", err)
+		return queuedMessage{}
+	}
+	return m
+}
+
 type BlockingList struct {
 	list *list.List
 	ch   chan struct{}
@@ -46,3 +87,233 @@ func (bl *BlockingList) Len() int {
 	defer bl.mu.Unlock()
 	return bl.list.Len()
 }
+
+type lockFreeNode struct {
+	value interface{}
+	next  atomic.Pointer[lockFreeNode]
+}
+
+// LockFreeQueue is an unbounded multi-producer multi-consumer queue
+// (Michael-Scott) with the same blocking semantics as BlockingList, without a
+// mutex on the push path.
+type LockFreeQueue struct {
+	head   atomic.Pointer[lockFreeNode]
+	tail   atomic.Pointer[lockFreeNode]
+	length atomic.Int64
+	ch     chan struct{}
+}
+
+func NewLockFreeQueue() *LockFreeQueue {
+	q := &LockFreeQueue{ch: make(chan struct{}, 1)}
+	sentinel := &lockFreeNode{}
+	q.head.Store(sentinel)
+	q.tail.Store(sentinel)
+	return q
+}
+
+func (q *LockFreeQueue) PushBack(v interface{}) {
+	node := &lockFreeNode{value: v}
+	for {
+		tail := q.tail.Load()
+		next := tail.next.Load()
+		if tail != q.tail.Load() {
+			continue
+		}
+		if next != nil {
+			// tail is lagging behind, help the other producer
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if tail.next.CompareAndSwap(nil, node) {
+			q.tail.CompareAndSwap(tail, node)
+			break
+		}
+	}
+	q.length.Add(1)
+	q.signal()
+}
+
+func (q *LockFreeQueue) signal() {
+	select {
+	case q.ch <- struct{}{}:
+	default:
+	}
+}
+
+// pop removes the front value, ok is false when the queue is empty
+func (q *LockFreeQueue) pop() (interface{}, bool) {
+	for {
+		head := q.head.Load()
+		tail := q.tail.Load()
+		next := head.next.Load()
+		if head != q.head.Load() {
+			continue
+		}
+		if next == nil {
+			return nil, false
+		}
+		if head == tail {
+			q.tail.CompareAndSwap(tail, next)
+			continue
+		}
+		if q.head.CompareAndSwap(head, next) {
+			v := next.value
+			// the new head is the sentinel, drop the reference to its value
+			next.value = nil
+			q.length.Add(-1)
+			return v, true
+		}
+	}
+}
+
+func (q *LockFreeQueue) FrontBlock() interface{} {
+	for {
+		if v, ok := q.pop(); ok {
+			if q.length.Load() > 0 {
+				// wake up another consumer for the remaining values
+				q.signal()
+			}
+			return v
+		}
+		<-q.ch
+	}
+}
+
+func (q *LockFreeQueue) Len() int {
+	return int(q.length.Load())
+}
+
+// RingQueue is a bounded queue backed by a ring buffer allocated once. When
+// it is full, PushBack waits for a consumer, applying back-pressure to the
+// logging goroutines instead of growing without bound.
+type RingQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	buf      []interface{}
+	head     int
+	length   int
+}
+
+// NewRingQueue returns a queue of capacity values, default 10000
+func NewRingQueue(capacity int) *RingQueue {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	q := &RingQueue{buf: make([]interface{}, capacity)}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *RingQueue) PushBack(v interface{}) {
+	q.mu.Lock()
+	for q.length == len(q.buf) {
+		q.notFull.Wait()
+	}
+	q.buf[(q.head+q.length)%len(q.buf)] = v
+	q.length++
+	q.mu.Unlock()
+	q.notEmpty.Signal()
+}
+
+func (q *RingQueue) FrontBlock() interface{} {
+	q.mu.Lock()
+	for q.length == 0 {
+		q.notEmpty.Wait()
+	}
+	v := q.buf[q.head]
+	q.buf[q.head] = nil
+	q.head = (q.head + 1) % len(q.buf)
+	q.length--
+	q.mu.Unlock()
+	q.notFull.Signal()
+	return v
+}
+
+func (q *RingQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length
+}
+
+type queueShard struct {
+	mu   sync.Mutex
+	list *list.List
+	// pad shards to separate cache lines
+	_ [40]byte
+}
+
+// ShardedQueue spreads values over several independently locked lists to
+// reduce contention between producers, which pick the shards round-robin.
+// Consumers start at the shard the next value goes to, the one written least
+// recently, and steal from the others when it is empty. Values are only
+// ordered within a shard.
+type ShardedQueue struct {
+	shards []queueShard
+	next   atomic.Uint32
+	length atomic.Int64
+	ch     chan struct{}
+}
+
+func NewShardedQueue(shards int) *ShardedQueue {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	q := &ShardedQueue{
+		shards: make([]queueShard, shards),
+		ch:     make(chan struct{}, 1),
+	}
+	for i := range q.shards {
+		q.shards[i].list = list.New()
+	}
+	return q
+}
+
+func (q *ShardedQueue) PushBack(v interface{}) {
+	shard := &q.shards[q.next.Add(1)%uint32(len(q.shards))]
+	shard.mu.Lock()
+	shard.list.PushBack(v)
+	shard.mu.Unlock()
+	q.length.Add(1)
+	select {
+	case q.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *ShardedQueue) pop() (interface{}, bool) {
+	start := int(q.next.Load()) + 1
+	for i := 0; i < len(q.shards); i++ {
+		shard := &q.shards[(start+i)%len(q.shards)]
+		shard.mu.Lock()
+		if e := shard.list.Front(); e != nil {
+			shard.list.Remove(e)
+			shard.mu.Unlock()
+			q.length.Add(-1)
+			return e.Value, true
+		}
+		shard.mu.Unlock()
+	}
+	return nil, false
+}
+
+func (q *ShardedQueue) FrontBlock() interface{} {
+	for {
+		if v, ok := q.pop(); ok {
+			if q.length.Load() > 0 {
+				// wake up another consumer for the remaining values
+				select {
+				case q.ch <- struct{}{}:
+				default:
+				}
+			}
+			return v
+		}
+		<-q.ch
+	}
+}
+
+func (q *ShardedQueue) Len() int {
+	return int(q.length.Load())
+}
@@ -0,0 +1,482 @@
+package graylog
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// diskQueueHeader length and crc32 of a record
+	diskQueueHeader = 8
+	diskQueueSuffix = ".seg"
+	diskQueueCursor = "cursor"
+)
+
+// DiskQueueOptions options of NewDiskQueue
+type DiskQueueOptions struct {
+	// Dir directory of the queue files, created when missing, required. It
+	// must not be shared between hooks or processes
+	Dir string
+	// SegmentSize size from which the messages are written to a new file, the
+	// files consumed entirely are removed. default 16MB
+	SegmentSize int64
+	// MaxBytes size of the messages not consumed yet from which PushBack waits
+	// for the consumers, default 1GB
+	MaxBytes int64
+	// Sync flushes every message to the disk before PushBack returns, so the
+	// queue survives a power loss and not only a crash of the process, at a
+	// large cost in throughput. default false
+	Sync bool
+}
+
+// DiskQueue is a Queue storing the messages in files, the messages still
+// queued when the process stops are sent once it restarts with the same
+// directory. The hook builds the messages before queueing them. A message
+// being sent when the process dies is lost. Values other than the hook's
+// messages, e.g. its worker control values, are kept in memory.
+type DiskQueue struct {
+	opts     DiskQueueOptions
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	// memory 不写入文件的值
+	memory *list.List
+	// w 写入的段
+	w    *os.File
+	wSeg uint64
+	wOff int64
+	// r 读取的段，读取位置保存在cursor文件
+	r      *os.File
+	rSeg   uint64
+	rOff   int64
+	cursor *os.File
+	// length size 文件中未消费的记录数和字节数
+	length int
+	size   int64
+	// skip 无法读取的段中剩余的记录数
+	skip   int
+	closed bool
+}
+
+// NewDiskQueue opens the queue in opts.Dir, recovering the messages left by
+// a previous process. A record torn by a crash ends its file, it is removed.
+func NewDiskQueue(opts DiskQueueOptions) (*DiskQueue, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("disk queue requires DiskQueueOptions.Dir")
+	}
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 16 << 20
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 1 << 30
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{opts: opts, memory: list.New()}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	if err := q.open(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) durable() {}
+
+func (q *DiskQueue) segmentPath(seg uint64) string {
+	return filepath.Join(q.opts.Dir, fmt.Sprintf("%020d%s", seg, diskQueueSuffix))
+}
+
+// segments 目录中的段编号，升序
+func (q *DiskQueue) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(q.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, diskQueueSuffix) {
+			continue
+		}
+		seg, err := strconv.ParseUint(strings.TrimSuffix(name, diskQueueSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, seg)
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+	return segs, nil
+}
+
+// open 读取cursor，删除已消费的段，统计未消费的记录并截掉残缺的记录
+func (q *DiskQueue) open() error {
+	cursor, err := os.OpenFile(filepath.Join(q.opts.Dir, diskQueueCursor), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	q.cursor = cursor
+	var buf [16]byte
+	hasCursor := false
+	if n, _ := cursor.ReadAt(buf[:], 0); n == len(buf) {
+		q.rSeg = binary.BigEndian.Uint64(buf[:8])
+		q.rOff = int64(binary.BigEndian.Uint64(buf[8:]))
+		hasCursor = true
+	}
+
+	segs, err := q.segments()
+	if err != nil {
+		return err
+	}
+	if !hasCursor && len(segs) > 0 {
+		q.rSeg = segs[0]
+	}
+	var live []uint64
+	for _, seg := range segs {
+		if seg < q.rSeg {
+			if err := os.Remove(q.segmentPath(seg)); err != nil {
+				return err
+			}
+			continue
+		}
+		live = append(live, seg)
+	}
+	if len(live) == 0 || live[0] != q.rSeg {
+		// 读取的段不存在，从剩下最早的段开始
+		if len(live) > 0 {
+			q.rSeg = live[0]
+		}
+		q.rOff = 0
+	}
+
+	for _, seg := range live {
+		var start int64
+		if seg == q.rSeg {
+			start = q.rOff
+		}
+		end, err := q.recover(seg, start)
+		if err != nil {
+			return err
+		}
+		if seg == q.rSeg && q.rOff > end {
+			q.rOff = end
+		}
+	}
+
+	q.wSeg = q.rSeg
+	if len(live) > 0 {
+		q.wSeg = live[len(live)-1]
+	}
+	if q.w, err = os.OpenFile(q.segmentPath(q.wSeg), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+		return err
+	}
+	info, err := q.w.Stat()
+	if err != nil {
+		return err
+	}
+	q.wOff = info.Size()
+	if q.r, err = os.Open(q.segmentPath(q.rSeg)); err != nil {
+		return err
+	}
+	q.saveCursor()
+	return nil
+}
+
+// recover 统计段中从start开始的完整记录，截掉之后的内容，返回段的长度
+func (q *DiskQueue) recover(seg uint64, start int64) (int64, error) {
+	f, err := os.OpenFile(q.segmentPath(seg), os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if start > info.Size() {
+		return info.Size(), nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, start, info.Size()-start))
+	end := start
+	var header [diskQueueHeader]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			break
+		}
+		n := int64(binary.BigEndian.Uint32(header[:4]))
+		if end+diskQueueHeader+n > info.Size() {
+			break
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			break
+		}
+		end += diskQueueHeader + n
+		q.length++
+		q.size += diskQueueHeader + n
+	}
+	if end < info.Size() {
+		internalLog.Printf("disk queue %s: dropping %d bytes of a torn record", f.Name(), info.Size()-end)
+		if err := f.Truncate(end); err != nil {
+			return 0, err
+		}
+	}
+	return end, nil
+}
+
+func (q *DiskQueue) saveCursor() {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], q.rSeg)
+	binary.BigEndian.PutUint64(buf[8:], uint64(q.rOff))
+	if _, err := q.cursor.WriteAt(buf[:], 0); err != nil {
+		internalLog.Printf("disk queue save cursor: %v", err)
+	}
+}
+
+// PushBack writes the hook's messages to the current file, waiting while
+// MaxBytes are queued. A message that can't be written is kept in memory.
+func (q *DiskQueue) PushBack(v interface{}) {
+	m, ok := v.(queuedMessage)
+	if !ok {
+		q.pushMemory(v)
+		return
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		internalLog.Printf("disk queue encode: %v", err)
+		q.pushMemory(v)
+		return
+	}
+	record := make([]byte, diskQueueHeader+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[diskQueueHeader:], payload)
+
+	q.mu.Lock()
+	for q.size >= q.opts.MaxBytes && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed || q.w == nil {
+		q.memory.PushBack(v)
+	} else if err := q.write(record); err != nil {
+		internalLog.Printf("disk queue write: %v", err)
+		q.memory.PushBack(v)
+	} else {
+		q.length++
+		q.size += int64(len(record))
+	}
+	q.mu.Unlock()
+	q.notEmpty.Signal()
+}
+
+func (q *DiskQueue) pushMemory(v interface{}) {
+	q.mu.Lock()
+	q.memory.PushBack(v)
+	q.mu.Unlock()
+	q.notEmpty.Signal()
+}
+
+// write 追加一条记录，段写满时切换到新的段，调用时持有mu
+func (q *DiskQueue) write(record []byte) error {
+	if _, err := q.w.Write(record); err != nil {
+		// 去掉写了一半的记录
+		_ = q.w.Truncate(q.wOff)
+		return err
+	}
+	if q.opts.Sync {
+		if err := q.w.Sync(); err != nil {
+			return err
+		}
+	}
+	q.wOff += int64(len(record))
+	if q.wOff >= q.opts.SegmentSize {
+		if err := q.rotate(); err != nil {
+			// 继续写入当前的段
+			internalLog.Printf("disk queue rotate: %v", err)
+		}
+	}
+	return nil
+}
+
+// rotate 开始写入下一个段
+func (q *DiskQueue) rotate() error {
+	w, err := os.OpenFile(q.segmentPath(q.wSeg+1), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if q.opts.Sync {
+		if d, err := os.Open(q.opts.Dir); err == nil {
+			_ = d.Sync()
+			_ = d.Close()
+		}
+	}
+	_ = q.w.Close()
+	q.w = w
+	q.wSeg++
+	q.wOff = 0
+	return nil
+}
+
+func (q *DiskQueue) FrontBlock() interface{} {
+	q.mu.Lock()
+	// 关闭后只能返回内存中的值
+	for q.memory.Len() == 0 && (q.length == 0 || q.closed) {
+		q.notEmpty.Wait()
+	}
+	var v interface{}
+	if e := q.memory.Front(); e != nil {
+		v = q.memory.Remove(e)
+	} else {
+		v = q.read()
+	}
+	q.mu.Unlock()
+	q.notFull.Signal()
+	return v
+}
+
+// read 读取下一条记录，调用时持有mu且length大于0
+func (q *DiskQueue) read() interface{} {
+	if q.skip > 0 {
+		q.skip--
+		q.length--
+		return queuedMessage{}
+	}
+	var header [diskQueueHeader]byte
+	for {
+		_, err := q.r.ReadAt(header[:], q.rOff)
+		if err == nil {
+			break
+		}
+		if q.rSeg < q.wSeg && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			if err := q.nextSegment(); err != nil {
+				return q.broken(err)
+			}
+			continue
+		}
+		return q.broken(err)
+	}
+	n := int64(binary.BigEndian.Uint32(header[:4]))
+	if diskQueueHeader+n > q.size {
+		return q.broken(fmt.Errorf("record of %d bytes exceeds the queued size", n))
+	}
+	payload := make([]byte, n)
+	if _, err := q.r.ReadAt(payload, q.rOff+diskQueueHeader); err != nil {
+		return q.broken(err)
+	}
+	q.rOff += diskQueueHeader + n
+	q.length--
+	q.size -= diskQueueHeader + n
+	if q.rSeg < q.wSeg {
+		// 段已写完，读到末尾时删除
+		if info, err := q.r.Stat(); err == nil && q.rOff >= info.Size() {
+			if err := q.nextSegment(); err != nil {
+				internalLog.Printf("disk queue next segment: %v", err)
+			}
+		}
+	}
+	q.saveCursor()
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		internalLog.Printf("disk queue %s: corrupted record", q.r.Name())
+		return queuedMessage{}
+	}
+	return decodeQueuedMessage(payload)
+}
+
+// nextSegment 删除读完的段，开始读取下一个段
+func (q *DiskQueue) nextSegment() error {
+	_ = q.r.Close()
+	if err := os.Remove(q.segmentPath(q.rSeg)); err != nil {
+		internalLog.Printf("disk queue remove segment: %v", err)
+	}
+	for q.rSeg < q.wSeg {
+		q.rSeg++
+		q.rOff = 0
+		r, err := os.Open(q.segmentPath(q.rSeg))
+		if err == nil {
+			q.r = r
+			q.saveCursor()
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return errors.New("no segment left to read")
+}
+
+// broken 读取失败时放弃文件中剩余的记录：之后的写入使用新的段，
+// 每条放弃的记录返回一个空消息，保持hook的计数一致
+func (q *DiskQueue) broken(err error) interface{} {
+	internalLog.Printf("disk queue read: %v, dropping %d queued messages", err, q.length)
+	q.skip = q.length
+	q.size = 0
+	if rotateErr := q.rotate(); rotateErr != nil {
+		internalLog.Printf("disk queue rotate: %v, keeping messages in memory", rotateErr)
+		_ = q.w.Close()
+		q.w = nil
+	}
+	if q.r != nil {
+		_ = q.r.Close()
+	}
+	for seg := q.rSeg; seg < q.wSeg; seg++ {
+		_ = os.Remove(q.segmentPath(seg))
+	}
+	q.rSeg = q.wSeg
+	q.rOff = 0
+	q.r = nil
+	if q.w != nil {
+		if q.r, err = os.Open(q.segmentPath(q.rSeg)); err != nil {
+			internalLog.Printf("disk queue open: %v, keeping messages in memory", err)
+			_ = q.w.Close()
+			q.w = nil
+		}
+	}
+	q.saveCursor()
+	return q.read()
+}
+
+// Len number of values queued, in the files and in memory
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length + q.memory.Len()
+}
+
+// Close closes the files, the values pushed afterwards are kept in memory
+func (q *DiskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.notFull.Broadcast()
+	return q.closeFiles()
+}
+
+func (q *DiskQueue) closeFiles() error {
+	var errs []error
+	for _, f := range []*os.File{q.w, q.r, q.cursor} {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
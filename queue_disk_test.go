@@ -0,0 +1,160 @@
+package graylog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func queuedShort(i int) queuedMessage {
+	return queuedMessage{
+		Message:  &GELFMessage{Version: GELFVersion11, Host: "h", Short: fmt.Sprint(i), Level: 6},
+		Enqueued: time.Unix(int64(i), 0),
+	}
+}
+
+func popShort(t *testing.T, q Queue) string {
+	t.Helper()
+	m, ok := q.FrontBlock().(queuedMessage)
+	if !ok || m.Message == nil {
+		t.Fatalf("popped %#v, want a message", m)
+	}
+	return m.Message.Short
+}
+
+func openDiskQueue(t *testing.T, opts DiskQueueOptions) *DiskQueue {
+	t.Helper()
+	q, err := NewDiskQueue(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestDiskQueueReopen(t *testing.T) {
+	dir := t.TempDir()
+	q := openDiskQueue(t, DiskQueueOptions{Dir: dir, SegmentSize: 256})
+	for i := 0; i < 20; i++ {
+		q.PushBack(queuedShort(i))
+	}
+	for i := 0; i < 5; i++ {
+		if got := popShort(t, q); got != fmt.Sprint(i) {
+			t.Fatalf("popped %s, want %d", got, i)
+		}
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q = openDiskQueue(t, DiskQueueOptions{Dir: dir, SegmentSize: 256})
+	if n := q.Len(); n != 15 {
+		t.Fatalf("reopened queue holds %d messages, want 15", n)
+	}
+	for i := 5; i < 20; i++ {
+		if got := popShort(t, q); got != fmt.Sprint(i) {
+			t.Fatalf("popped %s, want %d", got, i)
+		}
+	}
+	segs, err := q.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 1 {
+		t.Errorf("%d segments left after consuming everything, want 1", len(segs))
+	}
+}
+
+func TestDiskQueueTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	q := openDiskQueue(t, DiskQueueOptions{Dir: dir})
+	for i := 0; i < 3; i++ {
+		q.PushBack(queuedShort(i))
+	}
+	q.Close()
+
+	// a record cut short by a crash
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d%s", 0, diskQueueSuffix)), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+
+	q = openDiskQueue(t, DiskQueueOptions{Dir: dir})
+	if n := q.Len(); n != 3 {
+		t.Fatalf("queue holds %d messages, want 3", n)
+	}
+	q.PushBack(queuedShort(3))
+	for i := 0; i < 4; i++ {
+		if got := popShort(t, q); got != fmt.Sprint(i) {
+			t.Fatalf("popped %s, want %d", got, i)
+		}
+	}
+}
+
+func TestDiskQueueMemoryValues(t *testing.T) {
+	q := openDiskQueue(t, DiskQueueOptions{Dir: t.TempDir()})
+	q.PushBack(queuedShort(0))
+	q.PushBack(stopWorker{})
+	if _, ok := q.FrontBlock().(stopWorker); !ok {
+		t.Fatal("control value not returned first")
+	}
+	if got := popShort(t, q); got != "0" {
+		t.Fatalf("popped %s, want 0", got)
+	}
+}
+
+func TestDiskQueueMaxBytes(t *testing.T) {
+	q := openDiskQueue(t, DiskQueueOptions{Dir: t.TempDir(), MaxBytes: 1})
+	q.PushBack(queuedShort(0))
+	pushed := make(chan struct{})
+	go func() {
+		q.PushBack(queuedShort(1))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("PushBack didn't wait for the consumers")
+	case <-time.After(50 * time.Millisecond):
+	}
+	popShort(t, q)
+	<-pushed
+}
+
+func TestHookDiskQueue(t *testing.T) {
+	dir := t.TempDir()
+	q := openDiskQueue(t, DiskQueueOptions{Dir: dir})
+	q.PushBack(queuedShort(0))
+	q.Close()
+
+	q = openDiskQueue(t, DiskQueueOptions{Dir: dir})
+	recording := NewRecordingBackend()
+	hook := NewHook(HookOptions{Backend: recording, Queue: q})
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+	logger.WithError(errors.New("boom")).Info("after restart")
+	hook.Flush()
+
+	messages := recording.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("sent %d messages, want the recovered one and the new one", len(messages))
+	}
+	if messages[0].Short != "0" && messages[1].Short != "0" {
+		t.Error("recovered message not sent")
+	}
+	last := messages[0]
+	if last.Short == "0" {
+		last = messages[1]
+	}
+	if last.Short != "after restart" || last.Extra["_error"] != "boom" {
+		t.Errorf("sent %q with error %v", last.Short, last.Extra["_error"])
+	}
+}
@@ -0,0 +1,159 @@
+package graylog
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisQueuePoll bounds how long FrontBlock waits on redis before checking
+// the values kept in memory
+const redisQueuePoll = time.Second
+
+// RedisQueueOptions options of NewRedisQueue
+type RedisQueueOptions struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	// Key of the redis list holding the messages, default graylog:queue. It
+	// must not be shared between hooks
+	Key string
+	// Timeout bounds each push, default 5s
+	Timeout time.Duration
+}
+
+// RedisQueue is a Queue storing the messages in a redis list, the messages
+// still queued when the process stops are sent once it restarts with the same
+// key. The hook builds the messages before queueing them. A message being sent
+// when the process dies is lost. Values other than the hook's messages, e.g.
+// its worker control values, and the messages that can't be pushed while
+// redis is unavailable are kept in memory.
+type RedisQueue struct {
+	opts RedisQueueOptions
+	rdb  redis.UniversalClient
+
+	mu     sync.Mutex
+	memory *list.List
+	ch     chan struct{}
+
+	closed    atomic.Bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func NewRedisQueue(opts RedisQueueOptions) *RedisQueue {
+	if opts.Key == "" {
+		opts.Key = "graylog:queue"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &RedisQueue{
+		opts: opts,
+		rdb: redis.NewClient(&redis.Options{
+			Addr:     opts.Addr,
+			Username: opts.Username,
+			Password: opts.Password,
+			DB:       opts.DB,
+			// FrontBlock waits longer than the default read timeout
+			ReadTimeout: redisQueuePoll + 3*time.Second,
+		}),
+		memory: list.New(),
+		ch:     make(chan struct{}, 1),
+	}
+}
+
+func (q *RedisQueue) durable() {}
+
+func (q *RedisQueue) PushBack(v interface{}) {
+	if m, ok := v.(queuedMessage); ok && !q.closed.Load() {
+		payload, err := json.Marshal(m)
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), q.opts.Timeout)
+			err = q.rdb.RPush(ctx, q.opts.Key, payload).Err()
+			cancel()
+		}
+		if err == nil {
+			return
+		}
+		internalLog.Printf("redis queue push: %v", err)
+	}
+	q.mu.Lock()
+	q.memory.PushBack(v)
+	q.mu.Unlock()
+	select {
+	case q.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (q *RedisQueue) popMemory() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e := q.memory.Front(); e != nil {
+		return q.memory.Remove(e), true
+	}
+	return nil, false
+}
+
+// FrontBlock returns the values kept in memory first, then the messages of
+// the redis list
+func (q *RedisQueue) FrontBlock() interface{} {
+	for {
+		if v, ok := q.popMemory(); ok {
+			return v
+		}
+		if q.closed.Load() {
+			<-q.ch
+			continue
+		}
+		res, err := q.rdb.BLPop(context.Background(), redisQueuePoll, q.opts.Key).Result()
+		if err == nil && len(res) == 2 {
+			return decodeQueuedMessage([]byte(res[1]))
+		}
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if !q.closed.Load() {
+				internalLog.Printf("redis queue pop: %v", err)
+			}
+			select {
+			case <-q.ch:
+			case <-time.After(redisQueuePoll):
+			}
+		}
+	}
+}
+
+// Len number of values queued, in redis and in memory
+func (q *RedisQueue) Len() int {
+	q.mu.Lock()
+	n := q.memory.Len()
+	q.mu.Unlock()
+	if q.closed.Load() {
+		return n
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), q.opts.Timeout)
+	defer cancel()
+	length, err := q.rdb.LLen(ctx, q.opts.Key).Result()
+	if err != nil {
+		internalLog.Printf("redis queue length: %v", err)
+		return n
+	}
+	return n + int(length)
+}
+
+// Close closes the redis connections, the values pushed afterwards are kept
+// in memory
+func (q *RedisQueue) Close() error {
+	q.closeOnce.Do(func() {
+		q.closed.Store(true)
+		q.closeErr = q.rdb.Close()
+	})
+	return q.closeErr
+}
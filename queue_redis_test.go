@@ -0,0 +1,58 @@
+package graylog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisQueue(t *testing.T) {
+	mr := miniredis.RunT(t)
+	q := NewRedisQueue(RedisQueueOptions{Addr: mr.Addr()})
+	for i := 0; i < 5; i++ {
+		q.PushBack(queuedShort(i))
+	}
+	q.PushBack(stopWorker{})
+	if n := q.Len(); n != 6 {
+		t.Fatalf("queue holds %d values, want 6", n)
+	}
+	if _, ok := q.FrontBlock().(stopWorker); !ok {
+		t.Fatal("control value not returned first")
+	}
+	for i := 0; i < 2; i++ {
+		if got := popShort(t, q); got != fmt.Sprint(i) {
+			t.Fatalf("popped %s, want %d", got, i)
+		}
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the messages left are picked up by the next process
+	q = NewRedisQueue(RedisQueueOptions{Addr: mr.Addr()})
+	defer q.Close()
+	if n := q.Len(); n != 3 {
+		t.Fatalf("queue holds %d values, want 3", n)
+	}
+	for i := 2; i < 5; i++ {
+		if got := popShort(t, q); got != fmt.Sprint(i) {
+			t.Fatalf("popped %s, want %d", got, i)
+		}
+	}
+}
+
+func TestRedisQueueUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	q := NewRedisQueue(RedisQueueOptions{Addr: mr.Addr()})
+	defer q.Close()
+	mr.Close()
+	// kept in memory while redis is down
+	q.PushBack(queuedShort(0))
+	if got := popShort(t, q); got != "0" {
+		t.Fatalf("popped %s, want 0", got)
+	}
+}
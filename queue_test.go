@@ -0,0 +1,145 @@
+package graylog
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// queueStop 通知消费者退出
+type queueStop struct{}
+
+// benchmarkQueue measures PushBack from parallel producers, 1, 4 and 16 per
+// CPU, while GOMAXPROCS consumers drain the queue the way the hook's async
+// workers do
+func benchmarkQueue(b *testing.B, newQueue func() Queue) {
+	for _, producers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("producers=%dxCPU", producers), func(b *testing.B) {
+			benchmarkProducers(b, newQueue(), producers)
+		})
+	}
+}
+
+func benchmarkProducers(b *testing.B, q Queue, producers int) {
+	consumers := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, ok := q.FrontBlock().(queueStop); ok {
+					return
+				}
+			}
+		}()
+	}
+
+	b.SetParallelism(producers)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.PushBack(1)
+		}
+	})
+	for i := 0; i < consumers; i++ {
+		q.PushBack(queueStop{})
+	}
+	wg.Wait()
+}
+
+func BenchmarkQueueLockFree(b *testing.B) {
+	benchmarkQueue(b, func() Queue { return NewLockFreeQueue() })
+}
+
+func BenchmarkQueueRing(b *testing.B) {
+	benchmarkQueue(b, func() Queue { return NewRingQueue(0) })
+}
+
+func BenchmarkQueueBlockingList(b *testing.B) {
+	benchmarkQueue(b, func() Queue { return NewBlockingList() })
+}
+
+func BenchmarkQueueSharded(b *testing.B) {
+	benchmarkQueue(b, func() Queue { return NewShardedQueue(0) })
+}
+
+func BenchmarkQueueSharded16(b *testing.B) {
+	benchmarkQueue(b, func() Queue { return NewShardedQueue(16) })
+}
+
+// TestQueueStress pushes from many producers while many consumers pop, every
+// value must come out exactly once. Run it with -race.
+func TestQueueStress(t *testing.T) {
+	const producers, consumers, perProducer = 16, 8, 2000
+	queues := []struct {
+		name string
+		q    Queue
+	}{
+		{"sharded", NewShardedQueue(4)},
+		{"sharded single shard", NewShardedQueue(1)},
+		{"lock-free", NewLockFreeQueue()},
+		{"ring", NewRingQueue(64)},
+		{"blocking list", NewBlockingList()},
+	}
+	for _, tt := range queues {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make([]int32, producers*perProducer)
+			var mu sync.Mutex
+			remaining := len(seen)
+			// values aren't ordered across shards, stop the consumers once all were seen
+			all := make(chan struct{})
+			var consumed sync.WaitGroup
+			for i := 0; i < consumers; i++ {
+				consumed.Add(1)
+				go func() {
+					defer consumed.Done()
+					for {
+						v := tt.q.FrontBlock()
+						if _, ok := v.(queueStop); ok {
+							return
+						}
+						mu.Lock()
+						seen[v.(int)]++
+						remaining--
+						if remaining == 0 {
+							close(all)
+						}
+						mu.Unlock()
+					}
+				}()
+			}
+
+			var produced sync.WaitGroup
+			for p := 0; p < producers; p++ {
+				produced.Add(1)
+				go func(p int) {
+					defer produced.Done()
+					for i := 0; i < perProducer; i++ {
+						tt.q.PushBack(p*perProducer + i)
+						if i%100 == 0 {
+							_ = tt.q.Len()
+						}
+					}
+				}(p)
+			}
+			produced.Wait()
+			<-all
+			for i := 0; i < consumers; i++ {
+				tt.q.PushBack(queueStop{})
+			}
+			consumed.Wait()
+
+			for v, n := range seen {
+				if n != 1 {
+					t.Fatalf("value %d consumed %d times", v, n)
+				}
+			}
+			if n := tt.q.Len(); n != 0 {
+				t.Fatalf("%d values left in the queue", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package graylog
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type RecoverOptions struct {
+	// Swallow don't re-panic after the crash report was sent, the deferring
+	// function returns normally. default false
+	Swallow bool
+}
+
+// RecoverAndLog sends a crash report of a panic, then panics again with the same
+// value. Defer it directly, recover only works in the deferred function itself:
+//
+//	defer graylog.RecoverAndLog(hook)
+//
+// The report holds the panic value, the stack in the full message and in
+// _stacktrace, and the goroutine in _goroutine_id and _goroutines. It is sent
+// synchronously like fatal entries, bounded by HookOptions.FatalTimeout.
+func RecoverAndLog(hook *Hook) {
+	if r := recover(); r != nil {
+		hook.reportPanic(r, debug.Stack(), RecoverOptions{})
+	}
+}
+
+// RecoverAndLogWithOptions is RecoverAndLog with options, defer it directly too
+func RecoverAndLogWithOptions(hook *Hook, opts RecoverOptions) {
+	if r := recover(); r != nil {
+		hook.reportPanic(r, debug.Stack(), opts)
+	}
+}
+
+func (u *Hook) reportPanic(r interface{}, stack []byte, opts RecoverOptions) {
+	data := map[string]interface{}{
+		"panic":        fmt.Sprint(r),
+		"goroutine_id": goroutineID(stack),
+		"goroutines":   runtime.NumGoroutine(),
+	}
+	if err, ok := r.(error); ok {
+		data[logrus.ErrorKey] = err
+	}
+
+	entry := gelfEntry{
+		Level:   logrus.PanicLevel,
+		Data:    data,
+		Message: fmt.Sprintf("panic: %v\n\n%s", r, stack),
+		Time:    time.Now(),
+	}
+	entry.File, entry.Line, entry.Function = panicSite()
+
+	m := u.buildMessage(entry)
+	if _, ok := m.Extra[StackTraceKey]; !ok {
+		m.Extra[StackTraceKey] = string(stack)
+	}
+	if err := u.sendUrgentMessage(m); err != nil {
+		internalLog.Printf("send crash report: %v\n", err)
+	}
+
+	if !opts.Swallow {
+		panic(r)
+	}
+}
+
+// goroutineID parses the id from the "goroutine 7 [running]:" header of a stack
+func goroutineID(stack []byte) int64 {
+	line, _, _ := bytes.Cut(stack, []byte("\n"))
+	fields := bytes.Fields(line)
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseInt(string(fields[1]), 10, 64)
+	return id
+}
+
+// panicSite 查找panic发生的位置，即runtime.gopanic的调用者
+func panicSite() (file string, line int, function string) {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	afterPanic := false
+	for {
+		frame, more := frames.Next()
+		if afterPanic {
+			return frame.File, frame.Line, frame.Function
+		}
+		afterPanic = frame.Function == "runtime.gopanic"
+		if !more {
+			return "", 0, ""
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package graylog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConsumerInfo a consumer of the redis queue, see ActiveConsumers
+type ConsumerInfo struct {
+	ID            string
+	LastHeartbeat time.Time
+}
+
+// ConsumerLister is implemented by the redis backend, to see which replicas
+// consume the queue
+type ConsumerLister interface {
+	ActiveConsumers(ctx context.Context) ([]ConsumerInfo, error)
+}
+
+// ConsumersKey redis sorted set of the consumers of the queue LogQueue, each
+// member a RedisOptions.ConsumerID scored by the unix time of its last heartbeat
+func ConsumersKey() string {
+	return "graylog:consumers:" + LogQueue
+}
+
+// defaultConsumerID hostname:pid
+func defaultConsumerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
+
+// heartbeatTTL a consumer missing three heartbeats is considered gone
+func (r *redisBackend) heartbeatTTL() time.Duration {
+	return 3 * r.opts.HeartbeatInterval
+}
+
+// register 登记消费者，同一ID已有活跃的消费者时失败
+func (r *redisBackend) register(ctx context.Context) error {
+	now := time.Now()
+	key := ConsumersKey()
+	stale := strconv.FormatInt(now.Add(-r.heartbeatTTL()).Unix(), 10)
+	if err := r.rdb.ZRemRangeByScore(ctx, key, "-inf", "("+stale).Err(); err != nil {
+		return err
+	}
+	added, err := r.rdb.ZAddNX(ctx, key, redis.Z{Score: float64(now.Unix()), Member: r.opts.ConsumerID}).Result()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return fmt.Errorf("redis consumer %s is already active, set a distinct RedisOptions.ConsumerID per replica", r.opts.ConsumerID)
+	}
+	return nil
+}
+
+// heartbeat 定期刷新心跳直到stop关闭，然后注销并关闭stopped
+func (r *redisBackend) heartbeat(stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+	ticker := time.NewTicker(r.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	key := ConsumersKey()
+	for {
+		select {
+		case now := <-ticker.C:
+			err := r.rdb.ZAdd(context.Background(), key, redis.Z{Score: float64(now.Unix()), Member: r.opts.ConsumerID}).Err()
+			if err != nil {
+				internalLog.Printf("redis consumer heartbeat: %v", err)
+			}
+		case <-stop:
+			if err := r.rdb.ZRem(context.Background(), key, r.opts.ConsumerID).Err(); err != nil {
+				internalLog.Printf("redis consumer unregister: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// ActiveConsumers returns the consumers whose heartbeat is recent, including
+// this one while LaunchConsume runs
+func (r *redisBackend) ActiveConsumers(ctx context.Context) ([]ConsumerInfo, error) {
+	since := strconv.FormatInt(time.Now().Add(-r.heartbeatTTL()).Unix(), 10)
+	members, err := r.rdb.ZRangeByScoreWithScores(ctx, ConsumersKey(), &redis.ZRangeBy{Min: since, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	consumers := make([]ConsumerInfo, 0, len(members))
+	for _, m := range members {
+		id, _ := m.Member.(string)
+		consumers = append(consumers, ConsumerInfo{ID: id, LastHeartbeat: time.Unix(int64(m.Score), 0)})
+	}
+	return consumers, nil
+}
+
+// limitInFlight 限制同时处理的消息数
+func (r *redisBackend) limitInFlight(f func(message *GELFMessage) error) func(message *GELFMessage) error {
+	if r.opts.MaxInFlight <= 0 {
+		return f
+	}
+	sem := make(chan struct{}, r.opts.MaxInFlight)
+	return func(message *GELFMessage) error {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		return f(message)
+	}
+}
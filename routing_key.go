@@ -0,0 +1,16 @@
+package graylog
+
+// RoutingKey computes the routing key of a message, shared by the transports
+// routing messages: the pulsar message key, the redis queue and the shard of
+// NewShardingBackend
+type RoutingKey func(message *GELFMessage) string
+
+// RoutingKeyField returns a RoutingKey reading an additional field, e.g.
+// "_tenant", "" when the message doesn't have it. A field name without the
+// leading underscore is accepted
+func RoutingKeyField(field string) RoutingKey {
+	key := fieldKey(field)
+	return func(message *GELFMessage) string {
+		return fieldValue(message, key)
+	}
+}
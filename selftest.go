@@ -0,0 +1,153 @@
+package graylog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SelfTestKey marks the probe message sent by SelfTest, so it can be filtered out
+const SelfTestKey = "_self_test"
+
+// peerCheckWait how long SelfTest waits for the peer to reject the probe
+const peerCheckWait = 500 * time.Millisecond
+
+// SelfTestCheck result of one step of SelfTest
+type SelfTestCheck struct {
+	Name     string
+	OK       bool
+	Skipped  bool
+	Detail   string
+	Duration time.Duration
+}
+
+// SelfTestReport diagnostics returned by Hook.SelfTest
+type SelfTestReport struct {
+	Host        string
+	Backend     string
+	Synchronous bool
+	// Workers running async workers, Pending entries queued or being sent
+	Workers int64
+	Pending int64
+	Checks  []SelfTestCheck
+}
+
+// OK reports whether no check failed
+func (r *SelfTestReport) OK() bool {
+	for _, c := range r.Checks {
+		if !c.OK && !c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *SelfTestReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "graylog hook self-test: host=%s backend=%s synchronous=%t workers=%d pending=%d\n",
+		r.Host, r.Backend, r.Synchronous, r.Workers, r.Pending)
+	for _, c := range r.Checks {
+		status := "ok"
+		if c.Skipped {
+			status = "skipped"
+		} else if !c.OK {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&b, "  %-8s %-7s %8s  %s\n", c.Name, status, c.Duration.Round(time.Microsecond), c.Detail)
+	}
+	return b.String()
+}
+
+func (r *SelfTestReport) add(name string, start time.Time, err error) error {
+	check := SelfTestCheck{Name: name, OK: err == nil, Duration: time.Since(start)}
+	if err != nil {
+		check.Detail = err.Error()
+	}
+	r.Checks = append(r.Checks, check)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (r *SelfTestReport) skip(name, detail string) {
+	r.Checks = append(r.Checks, SelfTestCheck{Name: name, Skipped: true, Detail: detail})
+}
+
+// peerChecker is implemented by backends able to tell whether the peer
+// accepted what was just sent
+type peerChecker interface {
+	checkPeer(wait time.Duration) error
+}
+
+// SelfTest sends a probe message, tagged with SelfTestKey, through the
+// configured backend and reports whether it went through, e.g. to fail fast
+// at boot. With a BackendFactory a fresh backend is created, which checks the
+// factory too. The returned error is nil when every check passed.
+func (u *Hook) SelfTest(ctx context.Context) (*SelfTestReport, error) {
+	report := &SelfTestReport{
+		Host:        u.host,
+		Synchronous: u.synchronous,
+		Workers:     u.workers.Load(),
+		Pending:     u.pending.Load(),
+	}
+
+	// backend
+	start := time.Now()
+	backend := u.currentBackend()
+	if backend == nil && u.opts.BackendFactory != nil {
+		var err error
+		backend, err = u.opts.BackendFactory()
+		if err != nil {
+			return report, report.add("backend", start, err)
+		}
+		defer backend.Close()
+	}
+	if backend == nil {
+		return report, report.add("backend", start, errors.New("no backend configured"))
+	}
+	report.Backend = fmt.Sprintf("%T", backend)
+	_ = report.add("backend", start, nil)
+
+	// send 发送可能无限重试，受ctx限制
+	start = time.Now()
+	m := u.buildMessage(gelfEntry{
+		Level:   logrus.InfoLevel,
+		Data:    map[string]interface{}{SelfTestKey[1:]: true},
+		Message: "graylog hook self-test",
+		Time:    start,
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- backend.SendMessage(m)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err := report.add("send", start, err); err != nil {
+		return report, err
+	}
+
+	// peer
+	checker, ok := backend.(peerChecker)
+	if !ok {
+		report.skip("peer", "not supported by backend")
+		return report, nil
+	}
+	wait := peerCheckWait
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		wait = time.Until(deadline)
+	}
+	start = time.Now()
+	if err := report.add("peer", start, checker.checkPeer(wait)); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,275 @@
+package graylog
+
+import (
+	"bufio"
+	"compress/zlib"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type GelfServerOptions struct {
+	// Addr listen address, e.g. udp://0.0.0.0:12201 or tcp://0.0.0.0:12201
+	Addr string
+	// ReadBufferSize size of the udp socket receive buffer (SO_RCVBUF) in bytes,
+	// default 0 (kernel default)
+	ReadBufferSize int
+	// ChunkTimeout how long incomplete chunked udp messages are kept, default 5s
+	ChunkTimeout time.Duration
+	// StreamCompression expect tcp connections compressed as one zlib stream,
+	// see GelfOptions.StreamCompression. default false
+	StreamCompression bool
+	// TLSConfig certificates of tls:// listen addresses, set ClientAuth and
+	// ClientCAs to require client certificates. Required for tls
+	TLSConfig *tls.Config
+	// Ack acknowledge every tcp message once f accepted it, for senders using
+	// GelfOptions.Ack. When f fails the connection is closed instead, so the
+	// sender resends the message. default false
+	Ack bool
+}
+
+// ackLen size of an ack: the big-endian sequence number of the acknowledged
+// message on its connection, starting at 1
+const ackLen = 8
+
+// GelfServer is a GELF input receiving messages over udp or tcp, e.g. to relay
+// them to another backend or in tests
+type GelfServer struct {
+	opts        GelfServerOptions
+	networkType NetworkType
+	addr        string
+	mu          sync.Mutex
+	packetConn  net.PacketConn
+	listener    net.Listener
+	// conns 已接受的tcp连接，Close时关闭
+	conns   map[net.Conn]struct{}
+	closed  bool
+	metrics consumerMetrics
+}
+
+func NewGelfServer(opts GelfServerOptions) (*GelfServer, error) {
+	networkType, addr, err := parseGelfAddr(opts.Addr, true)
+	if err != nil {
+		return nil, err
+	}
+	if networkType == DTLS {
+		return nil, errors.New("gelf server does not support dtls")
+	}
+
+	s := &GelfServer{opts: opts, networkType: networkType, addr: addr, conns: make(map[net.Conn]struct{})}
+	if !networkType.isTCP() {
+		if s.packetConn, err = net.ListenPacket(string(networkType), addr); err != nil {
+			return nil, err
+		}
+		if opts.ReadBufferSize > 0 {
+			if bc, ok := s.packetConn.(interface{ SetReadBuffer(int) error }); ok {
+				if err := bc.SetReadBuffer(opts.ReadBufferSize); err != nil {
+					_ = s.packetConn.Close()
+					return nil, err
+				}
+			}
+		}
+	} else if networkType == TLS {
+		if opts.TLSConfig == nil {
+			return nil, errors.New("tls address requires GelfServerOptions.TLSConfig")
+		}
+		if s.listener, err = tls.Listen("tcp", addr, opts.TLSConfig); err != nil {
+			return nil, err
+		}
+	} else {
+		if s.listener, err = net.Listen(string(networkType), addr); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Addr returns the address the server listens on, useful with port 0
+func (s *GelfServer) Addr() net.Addr {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr()
+	}
+	return s.listener.Addr()
+}
+
+// Serve receives messages and passes them to f until Close is called.
+// Malformed payloads and errors returned by f are printed and skipped, except
+// with Ack where a failing f closes the tcp connection.
+func (s *GelfServer) Serve(f func(message *GELFMessage) error) error {
+	if !s.networkType.isTCP() {
+		return s.serveUDP(f)
+	}
+	return s.serveTCP(f)
+}
+
+func (s *GelfServer) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *GelfServer) serveUDP(f func(message *GELFMessage) error) error {
+	assembler := NewChunkAssembler(s.opts.ChunkTimeout)
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		payload, err := assembler.Add(buf[:n])
+		if err != nil {
+			internalLog.Printf("gelf server: %v\n", err)
+			continue
+		}
+		if payload == nil {
+			continue
+		}
+		s.handle(payload, f)
+	}
+}
+
+func (s *GelfServer) serveTCP(f func(message *GELFMessage) error) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.untrack(conn)
+			if err := s.serveConn(conn, f); err != nil && !errors.Is(err, io.EOF) && !s.isClosed() {
+				internalLog.Printf("gelf server: %v\n", err)
+			}
+		}()
+	}
+}
+
+// track 记录连接，服务已关闭时返回false
+func (s *GelfServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *GelfServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	_ = conn.Close()
+}
+
+func (s *GelfServer) serveConn(conn net.Conn, f func(message *GELFMessage) error) error {
+	var r io.Reader = conn
+	if s.opts.StreamCompression {
+		zr, err := zlib.NewReader(conn)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	br := bufio.NewReader(r)
+	var seq uint64
+	for {
+		frame, err := br.ReadBytes('\x00')
+		if err != nil {
+			return err
+		}
+		if !s.opts.Ack {
+			s.handle(frame[:len(frame)-1], f)
+			continue
+		}
+
+		seq++
+		message, err := decodeMessage(frame[:len(frame)-1])
+		if err == nil {
+			err = f(message)
+			s.metrics.observe(err)
+			if err != nil {
+				// 不回ack，发送方重连后重发
+				return fmt.Errorf("message %d rejected: %w", seq, err)
+			}
+		} else {
+			// a malformed message won't get better when resent, acknowledge and drop it
+			s.metrics.observe(err)
+			internalLog.Printf("gelf server: %v\n", err)
+		}
+		var ack [ackLen]byte
+		binary.BigEndian.PutUint64(ack[:], seq)
+		if _, err := conn.Write(ack[:]); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *GelfServer) handle(payload []byte, f func(message *GELFMessage) error) {
+	err := decodeAndConsume(payload, f)
+	s.metrics.observe(err)
+	if err != nil {
+		internalLog.Printf("gelf server: %v\n", err)
+	}
+}
+
+func decodeAndConsume(payload []byte, f func(message *GELFMessage) error) error {
+	message, err := decodeMessage(payload)
+	if err != nil {
+		return err
+	}
+	return f(message)
+}
+
+func decodeMessage(payload []byte) (*GELFMessage, error) {
+	data, err := DecodePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	var message GELFMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	NormalizeMessage(&message)
+	return &message, nil
+}
+
+// ConsumerStats returns the server's consumer counters, udp and tcp inputs have no queue
+func (s *GelfServer) ConsumerStats() (ConsumerStats, error) {
+	return s.metrics.stats(), nil
+}
+
+// Close stops the server and closes the connected tcp clients, Serve returns
+// nil once their messages in progress were handled
+func (s *GelfServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	if s.packetConn != nil {
+		return s.packetConn.Close()
+	}
+	return s.listener.Close()
+}
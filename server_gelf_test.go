@@ -0,0 +1,70 @@
+package graylog
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGelfServerCloseWithConnectedClient(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		s, err := NewGelfServer(GelfServerOptions{Addr: "tcp://127.0.0.1:0", StreamCompression: compressed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan *GELFMessage, 1)
+		served := make(chan error, 1)
+		go func() {
+			served <- s.Serve(func(m *GELFMessage) error {
+				received <- m
+				return nil
+			})
+		}()
+
+		backend, err := NewGelfBackendWithOptions(GelfOptions{Addr: "tcp://" + s.Addr().String(), StreamCompression: compressed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := backend.SendMessage(&GELFMessage{Version: GELFVersion11, Host: "h", Short: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case m := <-received:
+			if m.Short != "hello" {
+				t.Fatalf("received %q", m.Short)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+
+		// the client stays connected
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-served:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Serve still waiting for the connected client")
+		}
+		_ = backend.Close()
+	}
+}
+
+func TestGelfServerCloseBeforeServe(t *testing.T) {
+	s, err := NewGelfServer(GelfServerOptions{Addr: "tcp://127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = s.Close()
+	if err := s.Serve(func(*GELFMessage) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,36 @@
+package graylog
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StreamKey additional field naming the graylog stream a message belongs to.
+// Graylog stream rules can match on it, e.g. "_stream must match exactly payments".
+const StreamKey = "_stream"
+
+// streamField logrus field name that ends up as StreamKey
+const streamField = "stream"
+
+type streamContextKey struct{}
+
+// WithStream tags the entry with the given stream
+func WithStream(entry *logrus.Entry, stream string) *logrus.Entry {
+	return entry.WithField(streamField, stream)
+}
+
+// ContextWithStream returns a context carrying the stream, used by the hook for
+// entries logged with logrus.WithContext(ctx) that have no stream field
+func ContextWithStream(ctx context.Context, stream string) context.Context {
+	return context.WithValue(ctx, streamContextKey{}, stream)
+}
+
+// StreamFromContext returns the stream stored by ContextWithStream
+func StreamFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	stream, ok := ctx.Value(streamContextKey{}).(string)
+	return stream, ok
+}
@@ -0,0 +1,95 @@
+package testharness
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	graylog "github.com/viruscoding/logrus-graylog-hook"
+)
+
+// ErrInjected is returned by a FaultyBackend for the sends it fails
+var ErrInjected = errors.New("testharness: injected fault")
+
+// Faults what a FaultyBackend does to the sends going through it
+type Faults struct {
+	// Down fails every send, e.g. to simulate an outage
+	Down bool
+	// ErrorRate probability, from 0 to 1, of a send failing
+	ErrorRate float64
+	// Latency added before every send, failed ones included
+	Latency time.Duration
+}
+
+// FaultyBackend decorates a backend, failing sends with ErrInjected and
+// slowing them down as configured. Close and LaunchConsume are passed through.
+type FaultyBackend struct {
+	graylog.Backend
+	mu       sync.Mutex
+	faults   Faults
+	failNext int
+	rand     *rand.Rand
+	sent     atomic.Int64
+	failed   atomic.Int64
+}
+
+func NewFaultyBackend(inner graylog.Backend, faults Faults) *FaultyBackend {
+	return &FaultyBackend{
+		Backend: inner,
+		faults:  faults,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetFaults replaces the injected faults, e.g. SetFaults(Faults{}) ends an outage
+func (f *FaultyBackend) SetFaults(faults Faults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults = faults
+}
+
+// FailNext fails the next n sends, on top of the configured faults
+func (f *FaultyBackend) FailNext(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failNext = n
+}
+
+// fail 决定本次发送是否失败
+func (f *FaultyBackend) fail() (bool, time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failNext > 0 {
+		f.failNext--
+		return true, f.faults.Latency
+	}
+	return f.faults.Down || f.rand.Float64() < f.faults.ErrorRate, f.faults.Latency
+}
+
+func (f *FaultyBackend) SendMessage(message *graylog.GELFMessage) error {
+	fail, latency := f.fail()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if fail {
+		f.failed.Add(1)
+		return ErrInjected
+	}
+	if err := f.Backend.SendMessage(message); err != nil {
+		return err
+	}
+	f.sent.Add(1)
+	return nil
+}
+
+// Sent returns the number of messages passed to the decorated backend successfully
+func (f *FaultyBackend) Sent() int64 {
+	return f.sent.Load()
+}
+
+// Failed returns the number of sends failed with ErrInjected
+func (f *FaultyBackend) Failed() int64 {
+	return f.failed.Load()
+}
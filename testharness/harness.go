@@ -0,0 +1,148 @@
+// Package testharness runs the pieces of a graylog logging pipeline in
+// process: a GELF server receiving what is sent to it, a redis backend on an
+// in-memory miniredis and a backend decorator injecting faults, so that
+// projects using the graylog hook can test their pipeline, failures included,
+// without external services.
+package testharness
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	graylog "github.com/viruscoding/logrus-graylog-hook"
+)
+
+type Options struct {
+	// GelfAddr listen address of the GELF server, udp or tcp. default
+	// tcp://127.0.0.1:0
+	GelfAddr string
+	// Faults initially injected by the backends created by the harness
+	Faults Faults
+}
+
+// Harness the in-process services of a test, stopped when the test ends
+type Harness struct {
+	t      testing.TB
+	opts   Options
+	server *graylog.GelfServer
+	redis  *miniredis.Miniredis
+
+	mu       sync.Mutex
+	received []*graylog.GELFMessage
+	// notify 收到消息时通知WaitReceived
+	notify chan struct{}
+}
+
+// New starts the GELF server and miniredis, failing the test when they can't
+// be started. Everything is stopped by t.Cleanup.
+func New(t testing.TB, opts Options) *Harness {
+	t.Helper()
+	if opts.GelfAddr == "" {
+		opts.GelfAddr = "tcp://127.0.0.1:0"
+	}
+	server, err := graylog.NewGelfServer(graylog.GelfServerOptions{Addr: opts.GelfAddr})
+	if err != nil {
+		t.Fatalf("start gelf server: %v", err)
+	}
+	h := &Harness{
+		t:      t,
+		opts:   opts,
+		server: server,
+		redis:  miniredis.RunT(t),
+		notify: make(chan struct{}, 1),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := server.Serve(h.record); err != nil {
+			t.Errorf("gelf server: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+		<-done
+	})
+	return h
+}
+
+func (h *Harness) record(message *graylog.GELFMessage) error {
+	h.mu.Lock()
+	h.received = append(h.received, message)
+	h.mu.Unlock()
+	select {
+	case h.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// GelfAddr returns the address of the GELF server, e.g. tcp://127.0.0.1:41234
+func (h *Harness) GelfAddr() string {
+	scheme, _, _ := strings.Cut(h.opts.GelfAddr, "://")
+	return scheme + "://" + h.server.Addr().String()
+}
+
+// Redis returns the miniredis server, e.g. to inspect the queued tasks or
+// to simulate a redis outage with SetError
+func (h *Harness) Redis() *miniredis.Miniredis {
+	return h.redis
+}
+
+// GelfBackend returns a gelf backend sending to the GELF server, with
+// opts.Addr set to GelfAddr, behind a FaultyBackend. It is closed when the
+// test ends.
+func (h *Harness) GelfBackend(opts graylog.GelfOptions) *FaultyBackend {
+	h.t.Helper()
+	opts.Addr = h.GelfAddr()
+	backend, err := graylog.NewGelfBackendWithOptions(opts)
+	if err != nil {
+		h.t.Fatalf("create gelf backend: %v", err)
+	}
+	return h.faulty(backend)
+}
+
+// RedisBackend returns a redis backend on miniredis, with opts.Addr set,
+// behind a FaultyBackend. It is closed when the test ends.
+func (h *Harness) RedisBackend(opts graylog.RedisOptions) *FaultyBackend {
+	opts.Addr = h.redis.Addr()
+	return h.faulty(graylog.NewRedisBackend(opts))
+}
+
+func (h *Harness) faulty(backend graylog.Backend) *FaultyBackend {
+	faulty := NewFaultyBackend(backend, h.opts.Faults)
+	h.t.Cleanup(func() {
+		_ = faulty.Close()
+	})
+	return faulty
+}
+
+// Received returns a copy of the messages received by the GELF server, oldest first
+func (h *Harness) Received() []*graylog.GELFMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	received := make([]*graylog.GELFMessage, len(h.received))
+	copy(received, h.received)
+	return received
+}
+
+// WaitReceived waits until the GELF server received at least n messages and
+// returns them, failing the test after timeout
+func (h *Harness) WaitReceived(n int, timeout time.Duration) []*graylog.GELFMessage {
+	h.t.Helper()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		if received := h.Received(); len(received) >= n {
+			return received
+		}
+		select {
+		case <-h.notify:
+		case <-timer.C:
+			h.t.Fatalf("received %d messages after %s, expected %d", len(h.Received()), timeout, n)
+			return nil
+		}
+	}
+}
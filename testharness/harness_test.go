@@ -0,0 +1,61 @@
+package testharness
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	graylog "github.com/viruscoding/logrus-graylog-hook"
+)
+
+func message(short string) *graylog.GELFMessage {
+	return &graylog.GELFMessage{Version: graylog.GELFVersion11, Host: "h", Short: short}
+}
+
+func TestHarnessGelf(t *testing.T) {
+	h := New(t, Options{})
+	backend := h.GelfBackend(graylog.GelfOptions{})
+	for _, short := range []string{"a", "b"} {
+		if err := backend.SendMessage(message(short)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := h.WaitReceived(2, 5*time.Second)
+	if received[0].Short != "a" || received[1].Short != "b" {
+		t.Fatalf("received %q and %q", received[0].Short, received[1].Short)
+	}
+}
+
+func TestHarnessFaults(t *testing.T) {
+	h := New(t, Options{Faults: Faults{Down: true}})
+	backend := h.GelfBackend(graylog.GelfOptions{})
+	if err := backend.SendMessage(message("x")); !errors.Is(err, ErrInjected) {
+		t.Fatalf("SendMessage = %v, want ErrInjected", err)
+	}
+	backend.SetFaults(Faults{})
+	backend.FailNext(1)
+	if err := backend.SendMessage(message("x")); !errors.Is(err, ErrInjected) {
+		t.Fatalf("SendMessage = %v, want ErrInjected", err)
+	}
+	if err := backend.SendMessage(message("y")); err != nil {
+		t.Fatal(err)
+	}
+	if backend.Sent() != 1 || backend.Failed() != 2 {
+		t.Fatalf("sent %d failed %d, want 1 and 2", backend.Sent(), backend.Failed())
+	}
+}
+
+// TestHarnessClosedBackends closes the backends before the cleanup closes
+// them again
+func TestHarnessClosedBackends(t *testing.T) {
+	h := New(t, Options{})
+	redis := h.RedisBackend(graylog.RedisOptions{BatchWindow: 10 * time.Millisecond})
+	if err := redis.SendMessage(message("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := redis.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gelf := h.GelfBackend(graylog.GelfOptions{})
+	_ = gelf.Close()
+}